@@ -0,0 +1,70 @@
+package main
+
+import (
+	"github.com/synology-cloud-sync-decrypt-tool/syndecrypt-go/pkg/files"
+)
+
+// 进程退出码。多种失败同时出现时依次取凭据错误、完整性错误、全部失败、部分失败
+const (
+	// exitOK 所有文件解密成功或按冲突策略跳过
+	exitOK = 0
+	// exitUsage 参数错误或无法读取密钥等配置
+	exitUsage = 1
+	// exitPartialFailure 部分文件失败
+	exitPartialFailure = 2
+	// exitAllFailed 所有文件都失败
+	exitAllFailed = 3
+	// exitCredentials 密码、私钥、私钥口令错误或密钥对不匹配
+	exitCredentials = 4
+	// exitIntegrity 解密结果未通过 file_md5 校验
+	exitIntegrity = 5
+	// exitCanceled 被 Ctrl-C 或 SIGTERM 取消
+	exitCanceled = 130
+)
+
+// isCredentialClass 判断错误类别是否属于凭据错误
+func isCredentialClass(class string) bool {
+	switch class {
+	case "wrong_password", "wrong_key", "key_mismatch", "passphrase":
+		return true
+	}
+	return false
+}
+
+// credentialExitCode 加载凭据失败时的退出码
+func credentialExitCode(err error) int {
+	if isCredentialClass(files.ErrorClass(err)) {
+		return exitCredentials
+	}
+	return exitUsage
+}
+
+// resultsExitCode 根据解密结果计算退出码
+func resultsExitCode(results *files.DecryptResults) int {
+	if results.FailedCount == 0 {
+		return exitOK
+	}
+
+	credential, integrity := false, false
+	for _, result := range results.Results {
+		if result.Success {
+			continue
+		}
+		if isCredentialClass(result.ErrorClass) {
+			credential = true
+		}
+		if result.ErrorClass == "integrity" {
+			integrity = true
+		}
+	}
+
+	switch {
+	case credential:
+		return exitCredentials
+	case integrity:
+		return exitIntegrity
+	case results.FailedCount == results.TotalFiles:
+		return exitAllFailed
+	}
+	return exitPartialFailure
+}
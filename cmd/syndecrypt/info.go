@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/synology-cloud-sync-decrypt-tool/syndecrypt-go/pkg/core"
+	"github.com/synology-cloud-sync-decrypt-tool/syndecrypt-go/pkg/files"
+)
+
+// fileInfoOutput info 子命令的 JSON 输出
+type fileInfoOutput struct {
+	File  string `json:"file"`
+	Error string `json:"error,omitempty"`
+	*core.FileInfo
+}
+
+// runInfo 打印每个加密文件的头部信息，返回进程退出码
+func runInfo(encryptedFiles []string, asJSON bool) int {
+	failed := 0
+	outputs := make([]fileInfoOutput, 0, len(encryptedFiles))
+
+	for _, encryptedFile := range encryptedFiles {
+		info, err := files.InspectFile(encryptedFile)
+		output := fileInfoOutput{File: encryptedFile, FileInfo: info}
+		if err != nil {
+			output.Error = err.Error()
+			failed++
+		}
+
+		if asJSON {
+			outputs = append(outputs, output)
+			continue
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "  ❌ %s - %s\n", encryptedFile, err)
+			continue
+		}
+		printFileInfo(encryptedFile, info)
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(outputs); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to encode JSON: %v\n", err)
+			return exitUsage
+		}
+	}
+
+	switch {
+	case failed == 0:
+		return exitOK
+	case failed == len(encryptedFiles):
+		return exitAllFailed
+	}
+	return exitPartialFailure
+}
+
+// printFileInfo 以文本形式打印文件头部信息
+func printFileInfo(filename string, info *core.FileInfo) {
+	fmt.Printf("文件: %s\n", filename)
+	fmt.Printf("  格式版本: %d.%d\n", info.VersionMajor, info.VersionMinor)
+	fmt.Printf("  密码密钥 (enc_key1): %s\n", presence(info.HasEncKey1))
+	fmt.Printf("  私钥密钥 (enc_key2): %s\n", presence(info.HasEncKey2))
+	fmt.Printf("  盐: %s\n", valueOrNone(info.Salt))
+	fmt.Printf("  key1_hash: %s\n", valueOrNone(info.Key1Hash))
+	fmt.Printf("  key2_hash: %s\n", valueOrNone(info.Key2Hash))
+	fmt.Printf("  session_key_hash: %s\n", valueOrNone(info.SessionKeyHash))
+	fmt.Printf("  摘要算法: %s\n", valueOrNone(info.Digest))
+	fmt.Printf("  file_md5: %s\n", valueOrNone(info.FileMD5))
+	fmt.Printf("  数据块数: %d\n", info.ChunkCount)
+	fmt.Printf("  密文大小: %d 字节\n", info.CiphertextSize)
+}
+
+func presence(present bool) string {
+	if present {
+		return "有"
+	}
+	return "无"
+}
+
+func valueOrNone(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
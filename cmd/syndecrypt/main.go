@@ -1,10 +1,16 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/docopt/docopt-go"
@@ -15,18 +21,59 @@ import (
 
 const version = "1.0.0"
 
+// pipelineMinSize 单个加密文件达到该大小时才以流水线方式解密，小文件不必承担启动协程的开销
+const pipelineMinSize = 64 << 20
+
 const usage = `Synology Cloud Sync Decryption Tool
 
 Usage:
-  syndecrypt (-p <password> | -k <private-key-file> -l <public-key-file>) -O <output-directory> <encrypted-file>...
+  syndecrypt [-p <password> | --password-file=<file> | --password-env=<var> | --password-stdin | -k <private-key-file> -l <public-key-file> | --key-zip=<file>] [--key-passphrase=<passphrase>] -O <output-directory> [--no-verify] [--jobs=<n>] [--on-conflict=<policy>] [--preserve=<attrs>] [--dry-run [--json]] [--report=<format>] [--report-file=<path>] [--fail-fast] [--include=<glob>]... [--exclude=<glob>]... [--min-size=<size>] [--max-size=<size>] [--newer-than=<time>] [--older-than=<time>] <encrypted-file>...
+  syndecrypt info [--json] <encrypted-file>...
+  syndecrypt verify-password [--config=<file> [--profile=<name>]] [-p <password> | --password-file=<file> | --password-env=<var> | --password-stdin | -k <private-key-file> -l <public-key-file> | --key-zip=<file>] [--key-passphrase=<passphrase>] [--include=<glob>]... [--exclude=<glob>]... [--min-size=<size>] [--max-size=<size>] [--newer-than=<time>] [--older-than=<time>] <encrypted-file>...
+  syndecrypt --config=<file> [--profile=<name>] [-p <password> | --password-file=<file> | --password-env=<var> | --password-stdin | -k <private-key-file> -l <public-key-file> | --key-zip=<file>] [--key-passphrase=<passphrase>] [-O <output-directory>] [--no-verify] [--jobs=<n>] [--on-conflict=<policy>] [--preserve=<attrs>] [--dry-run [--json]] [--report=<format>] [--report-file=<path>] [--fail-fast] [--include=<glob>]... [--exclude=<glob>]... [--min-size=<size>] [--max-size=<size>] [--newer-than=<time>] [--older-than=<time>] <encrypted-file>...
   syndecrypt (-h | --help)
   syndecrypt --version
 
 Options:
   -O <directory> --output-directory=<directory>  Output directory
-  -p <password> --password=<password>            Decryption password
+  -p <password> --password=<password>            Decryption password (visible in ps and shell history;
+                                                 prefer the options below or the prompt)
+  --password-file=<file>                 Read the password from a file (trailing newline removed)
+  --password-env=<var>                   Read the password from an environment variable
+  --password-stdin                       Read the password from standard input
   -k <file> --private-key-file=<file>        File containing decryption private key
   -l <file> --public-key-file=<file>        File containing decryption public key
+  --key-zip=<file>                       Cloud Sync exported key.zip (private.pem + public.pem)
+  --key-passphrase=<passphrase>          Passphrase of an encrypted private key (prompted if omitted)
+  --no-verify                            Skip file_md5 integrity verification
+  -j <n> --jobs=<n>                      Number of files to decrypt in parallel
+                                         (default 0 uses the number of CPUs)
+  --on-conflict=<policy>                 What to do when an output file already exists:
+                                         skip, overwrite, rename, fail or skip-if-same (default fail)
+  --preserve=<attrs>                     Copy attributes from encrypted files and directories,
+                                         comma separated: times, mode, owner (owner needs root)
+  --dry-run                              Print what would be decrypted (mappings, conflicts,
+                                         non-CSEnc files, total bytes) without writing anything;
+                                         needs no credentials
+  --json                                 Print info or dry-run output as JSON
+  --report=<format>                      Save a per-file report: json, csv or text
+  --report-file=<path>                   Report path (default: decryption_report.<ext> in the
+                                         output directory; format inferred from the extension)
+  --fail-fast                            Stop at the first file that fails
+  --include=<glob>                       Only decrypt files in directories matching a pattern
+                                         (repeatable; ** matches any number of directories,
+                                         patterns without / match the file name)
+  --exclude=<glob>                       Skip files and whole directories matching a pattern
+                                         (repeatable; takes precedence over --include)
+  --min-size=<size>                      Skip encrypted files smaller than size (e.g. 100K, 1.5M)
+  --max-size=<size>                      Skip encrypted files larger than size
+  --newer-than=<time>                    Only files modified after a date (2024-05-01) or within
+                                         an age (12h, 7d, 2w)
+  --older-than=<time>                    Only files modified before a date or age
+  --config=<file>                        Read options from a TOML or YAML profile file;
+                                         options given on the command line take precedence
+  --profile=<name>                       Profile to use (default: default_profile, the profile
+                                         named "default" or the only profile)
   -h --help                              Show this help message
   --version                              Show version
 
@@ -34,12 +81,41 @@ Examples:
   # Decrypt with password
   syndecrypt -p mysecretpassword -O output/ encrypted_file.cse
 
+  # Read the password from a file, an environment variable or a prompt
+  syndecrypt --password-file password.txt -O output/ encrypted_file.cse
+  SYNDECRYPT_PASSWORD=... syndecrypt --password-env SYNDECRYPT_PASSWORD -O output/ encrypted_file.cse
+  syndecrypt -O output/ encrypted_file.cse
+
   # Decrypt with private key
   syndecrypt -k private.pem -l public.pem -O output/ file1.cse file2.cse
 
+  # Decrypt with the key.zip exported by Cloud Sync
+  syndecrypt --key-zip key.zip -O output/ file1.cse
+
   # Recursive directory decryption
   syndecrypt -p mysecretpassword -O output/ /path/to/encrypted/dir/
 
+  # Only decrypt photos from the last week, skipping Synology thumbnail folders
+  syndecrypt -p mysecretpassword --include '*.jpg.cse' --exclude @eaDir --newer-than 7d -O output/ /path/to/encrypted/dir/
+
+  # Use the "photos" profile from a config file, overriding its conflict policy
+  syndecrypt --config restore.toml --profile photos --on-conflict rename /path/to/encrypted/dir/
+
+  # Show encrypted file headers without credentials
+  syndecrypt info encrypted_file.cse
+
+  # Check the password against the file header only, without decrypting
+  syndecrypt verify-password -p mysecretpassword /path/to/encrypted/dir/
+
+Exit codes:
+  0  All files decrypted (or skipped by --on-conflict)
+  1  Usage or configuration error
+  2  Some files failed
+  3  All files failed
+  4  Credential error (wrong password or key, key pair mismatch, wrong key passphrase)
+  5  Integrity error (file_md5 mismatch)
+  130  Canceled by Ctrl-C or SIGTERM
+
 More information:
   https://github.com/anojht/synology-cloud-sync-decrypt-tool
 `
@@ -48,16 +124,19 @@ func main() {
 	args, err := docopt.ParseDoc(usage)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to parse arguments: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitUsage)
 	}
 
 	if args["--version"].(bool) {
 		fmt.Printf("synology-decrypt version %s\n", version)
-		os.Exit(0)
+		os.Exit(exitOK)
 	}
 
-	// 解析参数
-	outputDir := args["--output-directory"].(string)
+	// 合并配置文件中的 profile，命令行选项优先
+	if err := applyConfig(args); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		os.Exit(exitUsage)
+	}
 
 	// 获取加密文件列表
 	var encryptedFiles []string
@@ -67,20 +146,49 @@ func main() {
 		encryptedFiles = []string{file}
 	}
 
+	// info 子命令只读取文件头部，不需要凭据
+	if info, ok := args["info"].(bool); ok && info {
+		asJSON, _ := args["--json"].(bool)
+		os.Exit(runInfo(encryptedFiles, asJSON))
+	}
+
+	// 解析输出目录和解密选项，verify-password 不需要它们
+	var outputDir string
+	var options files.DecryptOptions
+	if verify, _ := args["verify-password"].(bool); !verify {
+		outputDir, options, err = parseDecryptOptions(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(exitUsage)
+		}
+	}
+
+	// 试运行只遍历目录并读取文件头部，不需要凭据，也不创建输出目录
+	if dryRun, ok := args["--dry-run"].(bool); ok && dryRun {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		asJSON, _ := args["--json"].(bool)
+		code := runDryRun(ctx, encryptedFiles, outputDir, options, asJSON)
+		stop()
+		os.Exit(code)
+	}
+
 	// 创建解密配置
 	var config core.DecryptConfig
 
 	// 检查密码
-	if password, ok := args["--password"].(string); ok && password != "" {
-		config.Password = []byte(password)
+	password, err := loadPassword(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read password: %v\n", err)
+		os.Exit(exitUsage)
 	}
+	config.Password = password
 
 	// 检查私钥文件
 	if privateKeyFile, ok := args["--private-key-file"].(string); ok && privateKeyFile != "" {
 		privateKey, err := util.ReadBinaryFile(privateKeyFile)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Failed to read private key file: %v\n", err)
-			os.Exit(1)
+			os.Exit(exitUsage)
 		}
 		config.PrivateKey = privateKey
 	}
@@ -90,106 +198,234 @@ func main() {
 		publicKey, err := util.ReadBinaryFile(publicKeyFile)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Failed to read public key file: %v\n", err)
-			os.Exit(1)
+			os.Exit(exitUsage)
 		}
 		config.PublicKey = publicKey
 	}
 
+	// 检查私钥口令
+	if passphrase, ok := args["--key-passphrase"].(string); ok && passphrase != "" {
+		config.PrivateKeyPassphrase = []byte(passphrase)
+	}
+
+	// 检查 key.zip
+	if keyZip, ok := args["--key-zip"].(string); ok && keyZip != "" {
+		if err := files.LoadKeyZip(keyZip, &config); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load key zip: %v\n", err)
+			os.Exit(credentialExitCode(err))
+		}
+	}
+
+	// 加密私钥缺少口令时先提示输入，私钥在构建凭据时才解析
+	if config.PrivateKey != nil && config.PrivateKeyPassphrase == nil && core.IsEncryptedPrivateKey(config.PrivateKey) {
+		promptKeyPassphrase(&config)
+	}
+
+	// 没有提供任何凭据时在终端提示输入密码
+	if config.Password == nil && config.PrivateKey == nil {
+		password, err := promptPassword()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read password: %v\n", err)
+			os.Exit(exitUsage)
+		}
+		config.Password = password
+	}
+
+	// 检查是否跳过完整性校验
+	if noVerify, ok := args["--no-verify"].(bool); ok {
+		config.NoVerify = noVerify
+	}
+
 	// 验证配置
 	if err := files.ValidateConfig(config); err != nil {
 		fmt.Fprintf(os.Stderr, "Configuration validation failed: %v\n", err)
-		os.Exit(1)
+		os.Exit(credentialExitCode(err))
+	}
+
+	// 凭据只构建一次：私钥在这里解析并验证密钥对，口令错误时立即失败；
+	// 所有文件共享解析出的私钥和按 salt 缓存的派生密钥
+	credentials, err := core.NewCredentials(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load credentials: %v\n", err)
+		os.Exit(credentialExitCode(err))
+	}
+	config.Credentials = credentials
+
+	// verify-password 子命令只验证凭据，不解密数据；目录中只检查通过过滤条件的 CSEnc 文件
+	if verify, ok := args["verify-password"].(bool); ok && verify {
+		filter, err := parseFilter(args, time.Now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(exitUsage)
+		}
+		os.Exit(runVerifyPassword(encryptedFiles, config, filter))
+	}
+
+	// Ctrl-C 或 SIGTERM 时取消解密，删除未完成的输出文件
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// 解析报告格式和路径
+	report, err := parseReportOptions(args, outputDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(exitUsage)
 	}
 
 	// 确保输出目录存在
 	if err := util.EnsureDir(outputDir); err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to create output directory: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitUsage)
 	}
 
 	// 处理每个加密文件
 	results := files.NewDecryptResults()
 
 	for _, encryptedFile := range encryptedFiles {
-		result := processFileWithResult(encryptedFile, outputDir, config)
-		// 如果是目录，直接使用目录内的详细统计结果
-		if result.FileCount > 0 {
-			results.TotalFiles += result.FileCount
-			results.SuccessCount += result.SuccessCount
-			results.FailedCount += result.FailedCount
-		} else {
-			// 如果是单个文件，使用普通统计
-			results.AddResult(result)
+		processInput(ctx, encryptedFile, outputDir, config, options, results)
+		if ctx.Err() != nil {
+			break
+		}
+		if options.FailFast && results.FailedCount > 0 {
+			fmt.Fprintln(os.Stderr, "已在第一个失败后停止 (--fail-fast)")
+			break
 		}
 	}
 
-	// 显示结果摘要（只在控制台打印，不保存到文件）
+	// 显示结果摘要
 	results.PrintSummary()
+
+	// 按需保存逐个文件的报告，取消时也保存已完成的部分
+	if report.format != "" {
+		if err := results.SaveReportFile(report.path, report.format); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to save report: %v\n", err)
+		}
+	}
+
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "操作已取消，未完成的输出文件已删除")
+		stop()
+		os.Exit(exitCanceled)
+	}
+
+	stop()
+	os.Exit(resultsExitCode(results))
 }
 
-// processFileWithResult 处理单个文件或目录并返回结果
-func processFileWithResult(inputPath, outputDir string, config core.DecryptConfig) files.DecryptResult {
+// parseDecryptOptions 解析输出目录、并发数、冲突策略、保留属性、FailFast 和过滤条件
+func parseDecryptOptions(args map[string]interface{}) (string, files.DecryptOptions, error) {
+	var options files.DecryptOptions
+
+	// 使用配置文件时输出目录也可以来自 profile
+	outputDir, _ := args["--output-directory"].(string)
+	if outputDir == "" {
+		return "", options, errors.New("No output directory: use -O or set output_directory in the profile")
+	}
+
+	// 解析并发数
+	if jobs, ok := args["--jobs"].(string); ok && jobs != "" {
+		n, err := strconv.Atoi(jobs)
+		if err != nil || n < 0 {
+			return "", options, fmt.Errorf("Invalid --jobs value: %s", jobs)
+		}
+		options.Jobs = n
+	}
+
+	// 解析输出冲突策略
+	if policy, ok := args["--on-conflict"].(string); ok {
+		onConflict, err := files.ParseConflictPolicy(policy)
+		if err != nil {
+			return "", options, fmt.Errorf("Invalid --on-conflict value: %v", err)
+		}
+		options.OnConflict = onConflict
+	}
+
+	// 解析需要保留的属性
+	if attrs, ok := args["--preserve"].(string); ok {
+		preserve, err := files.ParsePreserve(attrs)
+		if err != nil {
+			return "", options, fmt.Errorf("Invalid --preserve value: %v", err)
+		}
+		options.Preserve = preserve
+	}
+
+	// 第一个文件失败后停止
+	if failFast, ok := args["--fail-fast"].(bool); ok {
+		options.FailFast = failFast
+	}
+
+	// 解析目录遍历的过滤条件，命令行直接给出的文件总是解密
+	filter, err := parseFilter(args, time.Now())
+	if err != nil {
+		return "", options, err
+	}
+	options.Filter = filter
+
+	return outputDir, options, nil
+}
+
+// processInput 处理单个文件或目录，把每个文件的结果记录到 results
+func processInput(ctx context.Context, inputPath, outputDir string, config core.DecryptConfig, options files.DecryptOptions, results *files.DecryptResults) {
 	startTime := time.Now()
 	result := files.DecryptResult{
-		InputFile:  inputPath,
-		StartTime:  startTime,
+		InputFile: inputPath,
+		StartTime: startTime,
 	}
 
 	info, err := os.Stat(inputPath)
 	if err != nil {
-		result.Error = fmt.Sprintf("cannot access file: %v", err)
+		result.SetError(fmt.Errorf("cannot access file: %v", err))
 		result.EndTime = time.Now()
 		result.Duration = result.EndTime.Sub(result.StartTime).String()
 		fmt.Printf("  ❌ %s - %s\n", inputPath, result.Error)
-		return result
+		results.AddResult(result)
+		return
 	}
 
 	if info.IsDir() {
-		// 如果是目录，递归处理并获取详细统计
-		dirResults, err := files.DecryptDirectory(inputPath, outputDir, config)
-		result.EndTime = time.Now()
-		result.Duration = result.EndTime.Sub(result.StartTime).String()
-
-		if err != nil {
-			result.Error = err.Error()
+		// 如果是目录，递归处理并记录目录内每个文件的结果，包括取消前已完成的部分
+		dirResults, err := files.DecryptDirectoryWithOptions(ctx, inputPath, outputDir, config, options)
+		results.Merge(dirResults)
+
+		// FailFast 停止时失败的文件已经记录在结果中
+		if err != nil && ctx.Err() == nil && !errors.Is(err, files.ErrFailFast) {
+			result.SetError(err)
+			result.OutputFile = outputDir
+			result.EndTime = time.Now()
+			result.Duration = result.EndTime.Sub(result.StartTime).String()
 			fmt.Printf("  ❌ 目录 %s - %s\n", inputPath, result.Error)
-			return result
+			results.AddResult(result)
 		}
-
-		// 目录处理成功，但我们需要返回目录内的详细统计结果
-		// 而不是把整个目录当作一个文件
-		result.Success = true
-		result.OutputFile = outputDir
-		result.FileCount = dirResults.TotalFiles
-		result.SuccessCount = dirResults.SuccessCount
-		result.FailedCount = dirResults.FailedCount
-
-		// 静默处理成功的目录解密，不输出成功信息
-		return result
+		return
 	}
 
 	// 如果是单个文件
 	outputFile := generateOutputFileName(inputPath, outputDir)
-	result.OutputFile = outputFile
-
-	err = files.DecryptFile(inputPath, outputFile, config)
-	result.EndTime = time.Now()
-	result.Duration = result.EndTime.Sub(result.StartTime).String()
 
-	if err != nil {
-		result.Error = err.Error()
+	// 单个大文件用所有核心以流水线方式解密数据块；目录中的文件已由工作池并行处理
+	if info.Size() >= pipelineMinSize {
+		config.Workers = runtime.NumCPU()
+	}
+	result = files.DecryptFileWithResult(ctx, inputPath, outputFile, config, options)
+	if ctx.Err() != nil {
+		// 被取消的文件不计入结果
+		return
+	}
+	if !result.Success {
 		fmt.Printf("  ❌ %s - %s\n", inputPath, result.Error)
-		return result
 	}
+	// 静默处理成功的文件解密，不输出成功信息
+	results.AddResult(result)
+}
 
-	// 获取文件大小
-	if info, err := os.Stat(outputFile); err == nil {
-		result.FileSize = info.Size()
+// promptKeyPassphrase 在终端提示输入私钥口令
+func promptKeyPassphrase(config *core.DecryptConfig) {
+	passphrase, err := util.ReadPassword("Private key passphrase: ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read private key passphrase: %v\n", err)
+		os.Exit(exitUsage)
 	}
-
-	result.Success = true
-	// 静默处理成功的文件解密，不输出成功信息
-	return result
+	config.PrivateKeyPassphrase = passphrase
 }
 
 // generateOutputFileName 生成输出文件名
@@ -227,6 +463,95 @@ func showProgress(current, total int64) {
 func handleError(message string, err error) {
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s: %v\n", message, err)
-		os.Exit(1)
+		os.Exit(exitUsage)
+	}
+}
+
+// reportOptions 命令行指定的报告格式和路径，format 为空时不保存报告
+type reportOptions struct {
+	format files.ReportFormat
+	path   string
+}
+
+// parseReportOptions 解析 --report 和 --report-file。只给出路径时按扩展名推断格式，
+// 只给出格式时保存到输出目录下的 decryption_report.<ext>
+func parseReportOptions(args map[string]interface{}, outputDir string) (reportOptions, error) {
+	var report reportOptions
+	format, _ := args["--report"].(string)
+	report.path, _ = args["--report-file"].(string)
+
+	switch {
+	case format != "":
+		parsed, err := files.ParseReportFormat(format)
+		if err != nil {
+			return report, fmt.Errorf("Invalid --report value: %v", err)
+		}
+		report.format = parsed
+	case report.path != "":
+		switch strings.ToLower(filepath.Ext(report.path)) {
+		case ".json":
+			report.format = files.ReportJSON
+		case ".csv":
+			report.format = files.ReportCSV
+		default:
+			report.format = files.ReportText
+		}
+	default:
+		return report, nil
 	}
-}
\ No newline at end of file
+
+	if report.path == "" {
+		ext := string(report.format)
+		if report.format == files.ReportText {
+			ext = "txt"
+		}
+		report.path = filepath.Join(outputDir, "decryption_report."+ext)
+	}
+	return report, nil
+}
+
+// parseFilter 解析 --include、--exclude、大小和修改时间条件
+func parseFilter(args map[string]interface{}, now time.Time) (files.Filter, error) {
+	var filter files.Filter
+	filter.Include, _ = args["--include"].([]string)
+	filter.Exclude, _ = args["--exclude"].([]string)
+
+	sizes := []struct {
+		option string
+		target *int64
+	}{
+		{"--min-size", &filter.MinSize},
+		{"--max-size", &filter.MaxSize},
+	}
+	for _, size := range sizes {
+		if value, ok := args[size.option].(string); ok && value != "" {
+			n, err := files.ParseSize(value)
+			if err != nil {
+				return filter, fmt.Errorf("Invalid %s value: %v", size.option, err)
+			}
+			*size.target = n
+		}
+	}
+
+	times := []struct {
+		option string
+		target *time.Time
+	}{
+		{"--newer-than", &filter.NewerThan},
+		{"--older-than", &filter.OlderThan},
+	}
+	for _, t := range times {
+		if value, ok := args[t.option].(string); ok && value != "" {
+			parsed, err := files.ParseFilterTime(value, now)
+			if err != nil {
+				return filter, fmt.Errorf("Invalid %s value: %v", t.option, err)
+			}
+			*t.target = parsed
+		}
+	}
+
+	if err := filter.Validate(); err != nil {
+		return filter, fmt.Errorf("Invalid filter: %v", err)
+	}
+	return filter, nil
+}
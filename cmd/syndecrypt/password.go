@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/synology-cloud-sync-decrypt-tool/syndecrypt-go/pkg/files"
+	"github.com/synology-cloud-sync-decrypt-tool/syndecrypt-go/pkg/util"
+)
+
+// loadPassword 按 -p、--password-file、--password-env、--password-stdin 的顺序读取密码，
+// 都没有给出时返回 nil
+func loadPassword(args map[string]interface{}) ([]byte, error) {
+	if password, ok := args["--password"].(string); ok && password != "" {
+		return []byte(password), nil
+	}
+
+	if passwordFile, ok := args["--password-file"].(string); ok && passwordFile != "" {
+		return files.LoadPasswordFromFile(passwordFile)
+	}
+
+	if name, ok := args["--password-env"].(string); ok && name != "" {
+		password, ok := os.LookupEnv(name)
+		if !ok || password == "" {
+			return nil, fmt.Errorf("environment variable %s is not set", name)
+		}
+		return []byte(password), nil
+	}
+
+	if stdin, ok := args["--password-stdin"].(bool); ok && stdin {
+		if util.IsTerminal(int(os.Stdin.Fd())) {
+			return nil, errors.New("--password-stdin requires the password to be piped in")
+		}
+		return files.ReadPassword(os.Stdin)
+	}
+
+	return nil, nil
+}
+
+// promptPassword 没有提供任何凭据时在终端提示输入密码，不回显
+func promptPassword() ([]byte, error) {
+	password, err := util.ReadPassword("Password: ")
+	if err != nil {
+		return nil, err
+	}
+	if len(password) == 0 {
+		return nil, errors.New("password is empty")
+	}
+	return password, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/synology-cloud-sync-decrypt-tool/syndecrypt-go/pkg/files"
+)
+
+// runDryRun 只遍历输入并读取文件头部，打印解密计划，不写入任何文件，返回进程退出码
+func runDryRun(ctx context.Context, inputPaths []string, outputDir string, options files.DecryptOptions, asJSON bool) int {
+	plan := files.NewDecryptPlan(options)
+
+	for _, inputPath := range inputPaths {
+		info, err := os.Stat(inputPath)
+		if err == nil && info.IsDir() {
+			err = plan.AddDirectory(ctx, inputPath, outputDir)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "  ❌ 目录 %s - %s\n", inputPath, err)
+				return exitUsage
+			}
+			continue
+		}
+		plan.AddFile(inputPath, generateOutputFileName(inputPath, outputDir))
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(plan); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to encode JSON: %v\n", err)
+			return exitUsage
+		}
+		return exitOK
+	}
+
+	plan.Print()
+	return exitOK
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/synology-cloud-sync-decrypt-tool/syndecrypt-go/pkg/config"
+)
+
+// credentialOptions 选择凭据来源的命令行选项
+var credentialOptions = []string{
+	"--password", "--password-file", "--password-env", "--password-stdin",
+	"--private-key-file", "--public-key-file", "--key-zip",
+}
+
+// applyConfig 读取 --config 指定的配置文件，把 --profile 选择的 profile 合并到 args。
+// 没有 --config 时不做任何事
+func applyConfig(args map[string]interface{}) error {
+	path, _ := args["--config"].(string)
+	if path == "" {
+		return nil
+	}
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+	name, _ := args["--profile"].(string)
+	profile, err := cfg.Profile(name)
+	if err != nil {
+		return err
+	}
+
+	mergeProfile(args, profile)
+	return nil
+}
+
+// mergeProfile 用 profile 补全命令行没有给出的选项，命令行选项优先。
+// 凭据和报告设置各自作为整体合并：命令行给出其中任一选项时忽略 profile 中的这一组，
+// 避免例如命令行的 -p 与 profile 的 key_zip 同时生效
+func mergeProfile(args map[string]interface{}, profile *config.Profile) {
+	if !anyArgSet(args, credentialOptions...) {
+		setArg(args, "--password", profile.Password)
+		setArg(args, "--password-file", profile.PasswordFile)
+		setArg(args, "--password-env", profile.PasswordEnv)
+		setFlag(args, "--password-stdin", profile.PasswordStdin)
+		setArg(args, "--private-key-file", profile.PrivateKeyFile)
+		setArg(args, "--public-key-file", profile.PublicKeyFile)
+		setArg(args, "--key-zip", profile.KeyZip)
+		setArg(args, "--key-passphrase", profile.KeyPassphrase)
+	}
+
+	if !anyArgSet(args, "--report", "--report-file") {
+		setArg(args, "--report", profile.Report)
+		setArg(args, "--report-file", profile.ReportFile)
+	}
+
+	setArg(args, "--output-directory", profile.OutputDirectory)
+	setArg(args, "--on-conflict", profile.OnConflict)
+	if profile.Jobs > 0 {
+		setArg(args, "--jobs", strconv.Itoa(profile.Jobs))
+	}
+	setArg(args, "--preserve", strings.Join(profile.Preserve, ","))
+	setFlag(args, "--no-verify", profile.NoVerify)
+	setFlag(args, "--fail-fast", profile.FailFast)
+
+	// 命令行给出的 --include 或 --exclude 替换 profile 中的同名列表
+	setList(args, "--include", profile.Include)
+	setList(args, "--exclude", profile.Exclude)
+	setArg(args, "--min-size", profile.MinSize)
+	setArg(args, "--max-size", profile.MaxSize)
+	setArg(args, "--newer-than", profile.NewerThan)
+	setArg(args, "--older-than", profile.OlderThan)
+}
+
+// anyArgSet 判断命令行是否给出了 names 中的任一选项
+func anyArgSet(args map[string]interface{}, names ...string) bool {
+	for _, name := range names {
+		switch value := args[name].(type) {
+		case string:
+			if value != "" {
+				return true
+			}
+		case bool:
+			if value {
+				return true
+			}
+		case []string:
+			if len(value) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setArg 在命令行没有给出选项时使用 profile 的值
+func setArg(args map[string]interface{}, name, value string) {
+	if value != "" && !anyArgSet(args, name) {
+		args[name] = value
+	}
+}
+
+// setList 在命令行没有给出可重复的选项时使用 profile 的列表
+func setList(args map[string]interface{}, name string, values []string) {
+	if len(values) > 0 && !anyArgSet(args, name) {
+		args[name] = values
+	}
+}
+
+// setFlag 打开 profile 中启用的开关，命令行无法关闭 profile 中打开的开关
+func setFlag(args map[string]interface{}, name string, value bool) {
+	if value {
+		args[name] = true
+	}
+}
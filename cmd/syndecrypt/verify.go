@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/synology-cloud-sync-decrypt-tool/syndecrypt-go/pkg/core"
+	"github.com/synology-cloud-sync-decrypt-tool/syndecrypt-go/pkg/files"
+)
+
+// runVerifyPassword 用文件头部验证每个输入的凭据，目录中检查第一个通过 filter 的 CSEnc 文件，
+// 返回进程退出码
+func runVerifyPassword(inputPaths []string, config core.DecryptConfig, filter files.Filter) int {
+	exitCode := exitOK
+
+	for _, inputPath := range inputPaths {
+		checkedFile, err := files.VerifyCredentialsWithFilter(inputPath, config, filter)
+		if err != nil {
+			fmt.Printf("  ❌ %s - %s\n", checkedFile, err)
+			// 凭据错误优先于其他错误
+			if code := credentialExitCode(err); exitCode != exitCredentials {
+				exitCode = code
+			}
+			continue
+		}
+		fmt.Printf("  ✅ %s - 凭据正确\n", checkedFile)
+	}
+
+	return exitCode
+}
@@ -2,4 +2,9 @@ module github.com/synology-cloud-sync-decrypt-tool/syndecrypt-go
 
 go 1.21
 
-require github.com/docopt/docopt-go v0.0.0-20180111231733-ee0de3bc6815
+require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/docopt/docopt-go v0.0.0-20180111231733-ee0de3bc6815
+	golang.org/x/crypto v0.33.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,375 @@
+// Package config 读取命名的解密配置（profile），支持 TOML 和 YAML
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format 配置文件格式
+type Format string
+
+const (
+	// FormatTOML TOML 格式
+	FormatTOML Format = "toml"
+	// FormatYAML YAML 格式
+	FormatYAML Format = "yaml"
+)
+
+// Config 配置文件的内容
+type Config struct {
+	// DefaultProfile 未指定 profile 时使用的名称
+	DefaultProfile string
+	Profiles       map[string]*Profile
+}
+
+// Profile 一组命名的解密设置，字段与命令行选项一一对应，零值表示未设置
+type Profile struct {
+	Name string
+
+	// 凭据来源
+	Password       string
+	PasswordFile   string
+	PasswordEnv    string
+	PasswordStdin  bool
+	PrivateKeyFile string
+	PublicKeyFile  string
+	KeyZip         string
+	KeyPassphrase  string
+
+	// 输出与解密选项
+	OutputDirectory string
+	OnConflict      string
+	Jobs            int
+	Preserve        []string
+	NoVerify        bool
+	FailFast        bool
+
+	// 报告
+	Report     string
+	ReportFile string
+
+	// 目录遍历的过滤条件，大小和时间使用与命令行相同的写法
+	Include   []string
+	Exclude   []string
+	MinSize   string
+	MaxSize   string
+	NewerThan string
+	OlderThan string
+}
+
+// HasCredentials 判断 profile 是否设置了任何凭据来源
+func (p *Profile) HasCredentials() bool {
+	return p.Password != "" || p.PasswordFile != "" || p.PasswordEnv != "" || p.PasswordStdin ||
+		p.PrivateKeyFile != "" || p.PublicKeyFile != "" || p.KeyZip != ""
+}
+
+// Load 读取配置文件，按扩展名选择格式（.toml、.yaml 或 .yml）。
+// profile 中的相对路径以配置文件所在目录为基准
+func Load(path string) (*Config, error) {
+	var format Format
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		format = FormatTOML
+	case ".yaml", ".yml":
+		format = FormatYAML
+	default:
+		return nil, fmt.Errorf("unknown config format: %s (want .toml, .yaml or .yml)", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	config, err := Parse(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	config.resolvePaths(filepath.Dir(path))
+	return config, nil
+}
+
+// Parse 解析配置内容
+func Parse(data []byte, format Format) (*Config, error) {
+	var tree map[string]interface{}
+	var err error
+	switch format {
+	case FormatTOML:
+		tree, err = parseTOML(string(data))
+	case FormatYAML:
+		tree, err = parseYAML(string(data))
+	default:
+		return nil, fmt.Errorf("unknown config format: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeConfig(tree)
+}
+
+// Profile 返回指定名称的 profile。name 为空时依次使用 default_profile、
+// 名为 default 的 profile 和唯一的 profile
+func (c *Config) Profile(name string) (*Profile, error) {
+	if name == "" {
+		name = c.DefaultProfile
+	}
+	if name == "" {
+		if _, ok := c.Profiles["default"]; ok {
+			name = "default"
+		} else if len(c.Profiles) == 1 {
+			for only := range c.Profiles {
+				name = only
+			}
+		} else {
+			return nil, fmt.Errorf("no profile selected (available: %s)", strings.Join(c.names(), ", "))
+		}
+	}
+
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %q not found (available: %s)", name, strings.Join(c.names(), ", "))
+	}
+	return profile, nil
+}
+
+// names 返回排序后的 profile 名称
+func (c *Config) names() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolvePaths 把 profile 中的相对路径转换为相对于 dir 的路径
+func (c *Config) resolvePaths(dir string) {
+	resolve := func(path *string) {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(dir, *path)
+		}
+	}
+	for _, profile := range c.Profiles {
+		resolve(&profile.PasswordFile)
+		resolve(&profile.PrivateKeyFile)
+		resolve(&profile.PublicKeyFile)
+		resolve(&profile.KeyZip)
+		resolve(&profile.OutputDirectory)
+		resolve(&profile.ReportFile)
+	}
+}
+
+// decodeConfig 把解析出的树转换为 Config，未知的键视为错误以便发现拼写错误
+func decodeConfig(tree map[string]interface{}) (*Config, error) {
+	config := &Config{Profiles: make(map[string]*Profile)}
+
+	for key, value := range tree {
+		switch normalizeKey(key) {
+		case "default_profile":
+			name, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("default_profile must be a string")
+			}
+			config.DefaultProfile = name
+		case "profiles":
+			profiles, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("profiles must be a table")
+			}
+			for name, fields := range profiles {
+				table, ok := fields.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("profile %s must be a table", name)
+				}
+				profile, err := decodeProfile(name, table)
+				if err != nil {
+					return nil, err
+				}
+				config.Profiles[name] = profile
+			}
+		default:
+			return nil, fmt.Errorf("unknown key %q", key)
+		}
+	}
+
+	if len(config.Profiles) == 0 {
+		return nil, fmt.Errorf("no profiles defined")
+	}
+	return config, nil
+}
+
+func decodeProfile(name string, table map[string]interface{}) (*Profile, error) {
+	profile := &Profile{Name: name}
+
+	stringFields := map[string]*string{
+		"password":         &profile.Password,
+		"password_file":    &profile.PasswordFile,
+		"password_env":     &profile.PasswordEnv,
+		"private_key_file": &profile.PrivateKeyFile,
+		"public_key_file":  &profile.PublicKeyFile,
+		"key_zip":          &profile.KeyZip,
+		"key_passphrase":   &profile.KeyPassphrase,
+		"output_directory": &profile.OutputDirectory,
+		"on_conflict":      &profile.OnConflict,
+		"report":           &profile.Report,
+		"report_file":      &profile.ReportFile,
+	}
+	timeFields := map[string]*string{
+		"newer_than": &profile.NewerThan,
+		"older_than": &profile.OlderThan,
+	}
+	boolFields := map[string]*bool{
+		"password_stdin": &profile.PasswordStdin,
+		"no_verify":      &profile.NoVerify,
+		"fail_fast":      &profile.FailFast,
+	}
+
+	// 表按 map 遍历，同一选项有两个写法时无法确定哪个生效，直接报错
+	seen := make(map[string]string)
+	for key, value := range table {
+		if value == nil {
+			continue
+		}
+		field := profileField(key)
+		if other, ok := seen[field]; ok {
+			first, second := other, key
+			if first > second {
+				first, second = second, first
+			}
+			return nil, fmt.Errorf("profile %s: %s and %s set the same option", name, first, second)
+		}
+		seen[field] = key
+	}
+
+	for key, value := range table {
+		// YAML 中没有值的键视为未设置
+		if value == nil {
+			continue
+		}
+		field := profileField(key)
+		if target, ok := timeFields[field]; ok {
+			// TOML 和 YAML 的日期时间类型转换为 ParseFilterTime 接受的 RFC 3339
+			switch v := value.(type) {
+			case string:
+				*target = v
+			case time.Time:
+				*target = v.Format(time.RFC3339Nano)
+			default:
+				return nil, fmt.Errorf("profile %s: %s must be a date or an age such as 7d", name, key)
+			}
+			continue
+		}
+		if target, ok := stringFields[field]; ok {
+			s, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("profile %s: %s must be a string", name, key)
+			}
+			*target = s
+			continue
+		}
+		if target, ok := boolFields[field]; ok {
+			b, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("profile %s: %s must be true or false", name, key)
+			}
+			*target = b
+			continue
+		}
+
+		switch field {
+		case "jobs":
+			n, ok := integer(value)
+			if !ok || n < 0 {
+				return nil, fmt.Errorf("profile %s: jobs must be a non-negative integer", name)
+			}
+			profile.Jobs = int(n)
+		case "preserve", "include", "exclude":
+			list, err := stringList(value)
+			if err != nil {
+				return nil, fmt.Errorf("profile %s: %s %v", name, key, err)
+			}
+			switch field {
+			case "preserve":
+				profile.Preserve = list
+			case "include":
+				profile.Include = list
+			default:
+				profile.Exclude = list
+			}
+		case "min_size", "max_size":
+			// 大小可以写成字节数或带单位的字符串，例如 100K
+			var size string
+			if n, ok := integer(value); ok {
+				size = strconv.FormatInt(n, 10)
+			} else if s, ok := value.(string); ok {
+				size = s
+			} else {
+				return nil, fmt.Errorf("profile %s: %s must be a size such as 100K", name, key)
+			}
+			if field == "min_size" {
+				profile.MinSize = size
+			} else {
+				profile.MaxSize = size
+			}
+		default:
+			return nil, fmt.Errorf("profile %s: unknown key %q", name, key)
+		}
+	}
+
+	return profile, nil
+}
+
+// integer 接受 TOML 的 int64 和 YAML 的 int
+func integer(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// stringList 接受字符串列表或逗号分隔的字符串
+func stringList(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		var list []string
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list, nil
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("must be a list of strings")
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("must be a list of strings")
+}
+
+// normalizeKey 允许键名使用连字符，例如 on-conflict 与 on_conflict 等价
+// profileField 返回 profile 键对应的选项名，output 是 output_directory 的别名
+func profileField(key string) string {
+	if field := normalizeKey(key); field != "output" {
+		return field
+	}
+	return "output_directory"
+}
+
+func normalizeKey(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), "-", "_")
+}
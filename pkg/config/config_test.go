@@ -0,0 +1,288 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testTOML = `
+# 每晚的恢复任务
+default_profile = "photos"
+
+[profiles.photos]
+password_file = "/etc/syndecrypt/photos.pw"
+output_directory = "/restore/photos"  # 输出目录
+on_conflict = "skip-if-same"
+jobs = 4
+preserve = ["times", "mode"]
+fail_fast = true
+report = "csv"
+report_file = "/var/log/photos.csv"
+include = ["**/*.jpg.cse", "**/*.png.cse"]
+exclude = ["@eaDir"]
+min_size = 1024
+newer_than = "7d"
+
+[profiles."key backup"]
+private-key-file = 'keys/private.pem'
+public_key_file = "keys/public.pem"
+key_passphrase = "a \"quoted\" #secret"
+output = "restore"
+preserve = [
+  "times",
+]
+`
+
+const testYAML = `
+---
+# 每晚的恢复任务
+default_profile: photos
+
+profiles:
+  photos:
+    password_file: /etc/syndecrypt/photos.pw
+    output_directory: "/restore/photos"  # 输出目录
+    on_conflict: skip-if-same
+    jobs: 4
+    preserve: [times, mode]
+    fail_fast: true
+    report: csv
+    report_file: /var/log/photos.csv
+    include:
+      - "**/*.jpg.cse"
+      - "**/*.png.cse"
+    exclude: "@eaDir"
+    min_size: 1024
+    newer_than: 7d
+  key backup:
+    private-key-file: keys/private.pem
+    public_key_file: 'keys/public.pem'
+    key_passphrase: "a \"quoted\" #secret"
+    output: restore
+    report:
+    preserve:
+    - times
+`
+
+func TestParse(t *testing.T) {
+	want := &Config{
+		DefaultProfile: "photos",
+		Profiles: map[string]*Profile{
+			"photos": {
+				Name:            "photos",
+				PasswordFile:    "/etc/syndecrypt/photos.pw",
+				OutputDirectory: "/restore/photos",
+				OnConflict:      "skip-if-same",
+				Jobs:            4,
+				Preserve:        []string{"times", "mode"},
+				FailFast:        true,
+				Report:          "csv",
+				ReportFile:      "/var/log/photos.csv",
+				Include:         []string{"**/*.jpg.cse", "**/*.png.cse"},
+				Exclude:         []string{"@eaDir"},
+				MinSize:         "1024",
+				NewerThan:       "7d",
+			},
+			"key backup": {
+				Name:            "key backup",
+				PrivateKeyFile:  "keys/private.pem",
+				PublicKeyFile:   "keys/public.pem",
+				KeyPassphrase:   `a "quoted" #secret`,
+				OutputDirectory: "restore",
+				Preserve:        []string{"times"},
+			},
+		},
+	}
+
+	tests := []struct {
+		format Format
+		text   string
+	}{
+		{FormatTOML, testTOML},
+		{FormatYAML, testYAML},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			got, err := Parse([]byte(tt.text), tt.format)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				for name, profile := range got.Profiles {
+					t.Logf("%s: %+v", name, *profile)
+				}
+				t.Errorf("Parse() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseFullSyntax(t *testing.T) {
+	// 内联表、多行字符串和 YAML 流式映射
+	tests := []struct {
+		format Format
+		text   string
+	}{
+		{FormatTOML, "profiles = { a = { jobs = 2, exclude = ['''x''', \"\"\"y\"\"\"] } }"},
+		{FormatYAML, "profiles: {a: {jobs: 2, exclude: [x, y]}}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			config, err := Parse([]byte(tt.text), tt.format)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			profile := config.Profiles["a"]
+			if profile.Jobs != 2 || !reflect.DeepEqual(profile.Exclude, []string{"x", "y"}) {
+				t.Errorf("profile = %+v", *profile)
+			}
+		})
+	}
+}
+
+func TestParseDatetimes(t *testing.T) {
+	// TOML 不带时区的日期按本地时间解释，带偏移量的保留偏移量；YAML 不带时区的时间为 UTC
+	tests := []struct {
+		format    Format
+		text      string
+		wantNewer string
+		wantOlder string
+	}{
+		{
+			FormatTOML,
+			"[profiles.a]\nnewer_than = 2024-05-01\nolder_than = 2024-05-01T12:00:00+02:00",
+			time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local).Format(time.RFC3339Nano),
+			"2024-05-01T12:00:00+02:00",
+		},
+		{
+			FormatTOML,
+			"[profiles.a]\nnewer_than = 2024-05-01T08:30:00\nolder_than = \"7d\"",
+			time.Date(2024, 5, 1, 8, 30, 0, 0, time.Local).Format(time.RFC3339Nano),
+			"7d",
+		},
+		{
+			FormatYAML,
+			"profiles:\n  a:\n    newer_than: 2024-05-01\n    older_than: \"2024-06-01\"",
+			"2024-05-01T00:00:00Z",
+			"2024-06-01",
+		},
+	}
+
+	for _, tt := range tests {
+		config, err := Parse([]byte(tt.text), tt.format)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", tt.text, err)
+		}
+		profile := config.Profiles["a"]
+		if profile.NewerThan != tt.wantNewer || profile.OlderThan != tt.wantOlder {
+			t.Errorf("Parse(%q) = %q, %q, want %q, %q", tt.text, profile.NewerThan, profile.OlderThan, tt.wantNewer, tt.wantOlder)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		text   string
+	}{
+		{"toml no profiles", FormatTOML, `default_profile = "a"`},
+		{"toml unknown key", FormatTOML, "[profiles.a]\njbos = 4"},
+		{"toml wrong type", FormatTOML, "[profiles.a]\njobs = \"4\""},
+		{"toml negative jobs", FormatTOML, "[profiles.a]\njobs = -1"},
+		{"toml duplicate key", FormatTOML, "[profiles.a]\njobs = 1\njobs = 2"},
+		{"toml duplicate table", FormatTOML, "[profiles.a]\n[profiles.a]"},
+		{"toml unterminated string", FormatTOML, "[profiles.a]\nreport = \"csv"},
+		{"toml unterminated array", FormatTOML, "[profiles.a]\npreserve = [\"times\""},
+		{"toml array of tables", FormatTOML, "[[profiles]]"},
+		{"toml missing value", FormatTOML, "[profiles.a]\nreport ="},
+		{"toml output alias twice", FormatTOML, "[profiles.a]\noutput = \"a\"\noutput_directory = \"b\""},
+		{"toml key spelled twice", FormatTOML, "[profiles.a]\nfail-fast = true\nfail_fast = false"},
+		{"toml time without date", FormatTOML, "[profiles.a]\nnewer_than = 12:00:00"},
+		{"toml time not a date", FormatTOML, "[profiles.a]\nnewer_than = 7"},
+		{"yaml unknown key", FormatYAML, "profiles:\n  a:\n    jbos: 4"},
+		{"yaml wrong type", FormatYAML, "profiles:\n  a:\n    fail_fast: yes"},
+		{"yaml duplicate key", FormatYAML, "profiles:\n  a:\n    jobs: 1\n    jobs: 2"},
+		{"yaml bad indentation", FormatYAML, "profiles:\n  a:\n    jobs: 1\n      report: csv"},
+		{"yaml output alias twice", FormatYAML, "profiles:\n  a:\n    output: a\n    output_directory: b"},
+		{"yaml tab", FormatYAML, "profiles:\n\ta:\n"},
+		{"yaml bad syntax", FormatYAML, "profiles:\n  a: [times"},
+		{"yaml top level list", FormatYAML, "- a"},
+		{"yaml profile not a table", FormatYAML, "profiles:\n  a: 1"},
+		{"yaml size not a size", FormatYAML, "profiles:\n  a:\n    min_size: [1]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.text), tt.format); err == nil {
+				t.Error("Parse() should fail")
+			}
+		})
+	}
+}
+
+func TestConfigProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		profile string
+		want    string
+		wantErr bool
+	}{
+		{name: "explicit", text: "[profiles.a]\n[profiles.b]", profile: "b", want: "b"},
+		{name: "default_profile", text: "default_profile = \"b\"\n[profiles.a]\n[profiles.b]", want: "b"},
+		{name: "named default", text: "[profiles.a]\n[profiles.default]", want: "default"},
+		{name: "only profile", text: "[profiles.a]", want: "a"},
+		{name: "ambiguous", text: "[profiles.a]\n[profiles.b]", wantErr: true},
+		{name: "not found", text: "[profiles.a]", profile: "b", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := Parse([]byte(tt.text), FormatTOML)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			profile, err := config.Profile(tt.profile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Profile(%q) error = %v, wantErr %v", tt.profile, err, tt.wantErr)
+			}
+			if err == nil && profile.Name != tt.want {
+				t.Errorf("Profile(%q) = %s, want %s", tt.profile, profile.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	for name, text := range map[string]string{"restore.toml": testTOML, "restore.yml": testYAML} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(text), 0644)
+
+		config, err := Load(path)
+		if err != nil {
+			t.Fatalf("Load(%s) error = %v", name, err)
+		}
+		// 相对路径以配置文件所在目录为基准，绝对路径不变
+		profile := config.Profiles["key backup"]
+		if want := filepath.Join(dir, "keys", "private.pem"); profile.PrivateKeyFile != want {
+			t.Errorf("%s: PrivateKeyFile = %s, want %s", name, profile.PrivateKeyFile, want)
+		}
+		if want := filepath.Join(dir, "restore"); profile.OutputDirectory != want {
+			t.Errorf("%s: OutputDirectory = %s, want %s", name, profile.OutputDirectory, want)
+		}
+		if got := config.Profiles["photos"].PasswordFile; got != "/etc/syndecrypt/photos.pw" {
+			t.Errorf("%s: PasswordFile = %s", name, got)
+		}
+	}
+
+	if _, err := Load(filepath.Join(dir, "restore.ini")); err == nil {
+		t.Error("Load() should reject unknown extensions")
+	}
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"errors"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// parseTOML 解析 TOML，整数为 int64，数组为 []interface{}，表为 map[string]interface{}，
+// 日期时间为 time.Time
+func parseTOML(text string) (map[string]interface{}, error) {
+	tree := make(map[string]interface{})
+	if _, err := toml.Decode(text, &tree); err != nil {
+		return nil, err
+	}
+	if err := localizeTimes(tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// localizeTimes 把不带时区的日期和日期时间转换为本地时区，与命令行一致。
+// toml 包用当前的本地偏移量表示它们（时区名为 datetime-local 等），跨夏令时的日期会差一小时
+func localizeTimes(value interface{}) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if t, ok := item.(time.Time); ok {
+				localized, err := localizeTime(t)
+				if err != nil {
+					return err
+				}
+				v[key] = localized
+			} else if err := localizeTimes(item); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			if t, ok := item.(time.Time); ok {
+				localized, err := localizeTime(t)
+				if err != nil {
+					return err
+				}
+				v[i] = localized
+			} else if err := localizeTimes(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func localizeTime(t time.Time) (time.Time, error) {
+	switch t.Location().String() {
+	case "datetime-local", "date-local":
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.Local), nil
+	case "time-local":
+		return time.Time{}, errors.New("time of day without a date is not supported")
+	}
+	return t, nil
+}
@@ -0,0 +1,13 @@
+package config
+
+import "gopkg.in/yaml.v3"
+
+// parseYAML 解析 YAML 1.2，整数为 int，列表为 []interface{}，映射为 map[string]interface{}。
+// 按 YAML 1.2，yes/no 是字符串而不是布尔值
+func parseYAML(text string) (map[string]interface{}, error) {
+	tree := make(map[string]interface{})
+	if err := yaml.Unmarshal([]byte(text), &tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"crypto/rsa"
+	"sync"
+)
+
+// maxCachedPasswordKeys 限制缓存的派生密钥数量，避免每个文件的 salt 都不同时无限增长
+const maxCachedPasswordKeys = 4096
+
+// Credentials 是由 DecryptConfig 预先构建的凭据，可在多个文件、多个协程之间共享：
+// 私钥只解析一次，密码经 CSENCPBKDF 派生出的密钥和 IV 按 salt 缓存，
+// 同一任务的文件共用 salt 时只需派生一次，之后每个文件的 enc_key1 直接用缓存的密钥解密
+type Credentials struct {
+	password   []byte
+	privateKey *rsa.PrivateKey
+	// kdf 为密码派生函数，默认为 CSENCPBKDF
+	kdf func(password, salt []byte) ([]byte, []byte, error)
+
+	mu           sync.Mutex
+	passwordKeys map[string]*passwordKey
+}
+
+// passwordKey 是按 salt 派生出的 AES 密钥和 IV，once 保证并发时只派生一次
+type passwordKey struct {
+	once sync.Once
+	key  []byte
+	iv   []byte
+	err  error
+}
+
+// NewCredentials 根据配置构建凭据。提供私钥时立即解析（需要时使用口令），
+// 同时提供公钥时用解析出的私钥验证密钥对
+func NewCredentials(config DecryptConfig) (*Credentials, error) {
+	c := &Credentials{
+		password:     config.Password,
+		kdf:          CSENCPBKDF,
+		passwordKeys: make(map[string]*passwordKey),
+	}
+
+	if config.PrivateKey != nil {
+		privateKey, err := ParseRSAPrivateKey(config.PrivateKey, config.PrivateKeyPassphrase)
+		if err != nil {
+			return nil, err
+		}
+		if config.PublicKey != nil {
+			if err := matchPublicKey(privateKey, config.PublicKey); err != nil {
+				return nil, err
+			}
+		}
+		c.privateKey = privateKey
+	}
+
+	return c, nil
+}
+
+// passwordSessionKey 用密码解出 enc_key1 中的会话密钥
+func (c *Credentials) passwordSessionKey(encKey1, salt []byte) ([]byte, error) {
+	pk := c.passwordKey(string(salt))
+	pk.once.Do(func() {
+		pk.key, pk.iv, pk.err = c.kdf(c.password, salt)
+	})
+	if pk.err != nil {
+		return nil, pk.err
+	}
+	return decryptWithKeyIV(encKey1, pk.key, pk.iv)
+}
+
+// passwordKey 返回 salt 对应的缓存项，缓存已满时返回不缓存的新项
+func (c *Credentials) passwordKey(salt string) *passwordKey {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if pk, ok := c.passwordKeys[salt]; ok {
+		return pk
+	}
+	pk := &passwordKey{}
+	if len(c.passwordKeys) < maxCachedPasswordKeys {
+		c.passwordKeys[salt] = pk
+	}
+	return pk
+}
+
+// privateKeySessionKey 用预先解析的私钥解出 enc_key2 中的会话密钥
+func (c *Credentials) privateKeySessionKey(encKey2 []byte) ([]byte, error) {
+	return decryptWithRSAKey(encKey2, c.privateKey)
+}
+
+// credentials 返回预先构建的凭据，未提供时为当前文件单独构建
+func (config DecryptConfig) credentials() (*Credentials, error) {
+	if config.Credentials != nil {
+		return config.Credentials, nil
+	}
+	return NewCredentials(config)
+}
@@ -0,0 +1,128 @@
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCredentialsDerivePasswordKeyOncePerSalt(t *testing.T) {
+	password := []byte("testpassword")
+	plaintext := []byte("shared credentials")
+
+	// 同一任务的文件共用 salt，但每个文件的会话密钥和 enc_key1 都不同
+	var encrypted [][]byte
+	for _, salt := range []string{"taskSaltA1", "taskSaltB2"} {
+		for i := 0; i < 16; i++ {
+			encrypted = append(encrypted, encryptTestData(t, plaintext, EncryptConfig{Password: password, Salt: salt}))
+		}
+	}
+
+	config := DecryptConfig{Password: password}
+	creds, err := NewCredentials(config)
+	if err != nil {
+		t.Fatalf("NewCredentials() error = %v", err)
+	}
+	var kdfCalls int32
+	creds.kdf = func(password, salt []byte) ([]byte, []byte, error) {
+		atomic.AddInt32(&kdfCalls, 1)
+		return CSENCPBKDF(password, salt)
+	}
+	config.Credentials = creds
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(encrypted))
+	for _, data := range encrypted {
+		wg.Add(1)
+		go func(data []byte) {
+			defer wg.Done()
+			var decrypted bytes.Buffer
+			if err := DecryptStream(bytes.NewReader(data), &decrypted, config); err != nil {
+				errs <- err
+				return
+			}
+			if !bytes.Equal(decrypted.Bytes(), plaintext) {
+				errs <- errors.New("decrypted data mismatch")
+			}
+		}(data)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("DecryptStream() error = %v", err)
+	}
+
+	if kdfCalls != 2 {
+		t.Errorf("CSENCPBKDF called %d times for %d files, want 2", kdfCalls, len(encrypted))
+	}
+}
+
+func TestCredentialsSharedPrivateKey(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	publicKeyDER := x509.MarshalPKCS1PublicKey(&privateKey.PublicKey)
+	plaintext := []byte("shared credentials")
+
+	config := DecryptConfig{PrivateKey: x509.MarshalPKCS1PrivateKey(privateKey), PublicKey: publicKeyDER}
+	creds, err := NewCredentials(config)
+	if err != nil {
+		t.Fatalf("NewCredentials() error = %v", err)
+	}
+	config.Credentials = creds
+
+	for i := 0; i < 4; i++ {
+		data := encryptTestData(t, plaintext, EncryptConfig{PublicKey: publicKeyDER})
+		var decrypted bytes.Buffer
+		if err := DecryptStream(bytes.NewReader(data), &decrypted, config); err != nil {
+			t.Fatalf("DecryptStream() error = %v", err)
+		}
+		if !bytes.Equal(decrypted.Bytes(), plaintext) {
+			t.Errorf("decrypted = %q, want %q", decrypted.Bytes(), plaintext)
+		}
+	}
+}
+
+func TestNewCredentialsErrors(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+
+	config := DecryptConfig{
+		PrivateKey: x509.MarshalPKCS1PrivateKey(privateKey),
+		PublicKey:  x509.MarshalPKCS1PublicKey(&otherKey.PublicKey),
+	}
+	if _, err := NewCredentials(config); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("NewCredentials() error = %v, want ErrKeyMismatch", err)
+	}
+
+	if _, err := NewCredentials(DecryptConfig{PrivateKey: []byte(testEncryptedPKCS8)}); !errors.Is(err, ErrPassphraseRequired) {
+		t.Errorf("NewCredentials() error = %v, want ErrPassphraseRequired", err)
+	}
+
+	// 加密私钥与匹配的公钥
+	passphrase := []byte("hunter2")
+	encryptedKey, err := ParseRSAPrivateKey([]byte(testEncryptedPKCS8), passphrase)
+	if err != nil {
+		t.Fatalf("ParseRSAPrivateKey() error = %v", err)
+	}
+	config = DecryptConfig{
+		PrivateKey:           []byte(testEncryptedPKCS8),
+		PrivateKeyPassphrase: passphrase,
+		PublicKey:            x509.MarshalPKCS1PublicKey(&encryptedKey.PublicKey),
+	}
+	if _, err := NewCredentials(config); err != nil {
+		t.Errorf("NewCredentials() error = %v", err)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/pem"
 	"errors"
 	"fmt"
 )
@@ -50,6 +51,9 @@ func MD5Hash(data []byte) []byte {
 
 // 去除PKCS7填充
 func StripPKCS7Padding(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty data")
+	}
 	if len(data)%16 != 0 {
 		return nil, errors.New("invalid length")
 	}
@@ -83,6 +87,21 @@ func DecryptWithPassword(ciphertext, password, salt []byte) ([]byte, error) {
 	return StripPKCS7Padding(decrypted)
 }
 
+// decryptWithKeyIV 使用已派生的密钥和 IV 解密并去除填充
+func decryptWithKeyIV(ciphertext, key, iv []byte) ([]byte, error) {
+	if len(ciphertext)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("ciphertext length %d is not a multiple of the block size", len(ciphertext))
+	}
+	decryptor, err := DecryptorWithKeyIV(key, iv)
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted := make([]byte, len(ciphertext))
+	decryptor.CryptBlocks(decrypted, ciphertext)
+	return StripPKCS7Padding(decrypted)
+}
+
 
 // 创建基于密码的解密器
 func DecryptorWithPassword(password, salt []byte) (cipher.BlockMode, error) {
@@ -114,23 +133,117 @@ func DecryptorWithKeyIV(key, iv []byte) (cipher.BlockMode, error) {
 
 // 使用私钥解密
 func DecryptWithPrivateKey(ciphertext, privateKey []byte) ([]byte, error) {
-	privKey, err := x509.ParsePKCS1PrivateKey(privateKey)
+	return DecryptWithPrivateKeyPassphrase(ciphertext, privateKey, nil)
+}
+
+// 使用可能加密的私钥解密，passphrase 用于解密私钥本身
+func DecryptWithPrivateKeyPassphrase(ciphertext, privateKey, passphrase []byte) ([]byte, error) {
+	privKey, err := ParseRSAPrivateKey(privateKey, passphrase)
 	if err != nil {
-		// 尝试解析PKCS8格式
-		privKeyInterface, err := x509.ParsePKCS8PrivateKey(privateKey)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse private key: %v", err)
-		}
-		var ok bool
-		privKey, ok = privKeyInterface.(*rsa.PrivateKey)
-		if !ok {
-			return nil, errors.New("not an RSA private key")
-		}
+		return nil, err
 	}
 
+	return decryptWithRSAKey(ciphertext, privKey)
+}
+
+// 使用已解析的私钥解密 (RSA-OAEP-SHA1)
+func decryptWithRSAKey(ciphertext []byte, privKey *rsa.PrivateKey) ([]byte, error) {
 	return rsa.DecryptOAEP(sha1.New(), rand.Reader, privKey, ciphertext, nil)
 }
 
+// 解析RSA私钥，支持DER、PEM (PKCS1/PKCS8) 以及口令保护的PKCS8和旧式加密PEM
+func ParseRSAPrivateKey(privateKey, passphrase []byte) (*rsa.PrivateKey, error) {
+	return parsePrivateKey(privateKey, passphrase)
+}
+
+// ErrKeyMismatch 表示公钥与私钥不属于同一密钥对
+var ErrKeyMismatch = errors.New("public key does not match private key")
+
+// matchPublicKey 检查公钥是否与已解析的私钥属于同一密钥对 (比较模数和指数)
+func matchPublicKey(privKey *rsa.PrivateKey, publicKey []byte) error {
+	pubKey, err := ParseRSAPublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	if privKey.PublicKey.E != pubKey.E || privKey.PublicKey.N.Cmp(pubKey.N) != 0 {
+		return ErrKeyMismatch
+	}
+	return nil
+}
+
+// 添加PKCS7填充
+func AddPKCS7Padding(data []byte) []byte {
+	pad := aes.BlockSize - len(data)%aes.BlockSize
+	padded := make([]byte, len(data)+pad)
+	copy(padded, data)
+	for i := len(data); i < len(padded); i++ {
+		padded[i] = byte(pad)
+	}
+	return padded
+}
+
+// 使用密码加密，DecryptWithPassword 的逆操作
+func EncryptWithPassword(plaintext, password, salt []byte) ([]byte, error) {
+	encryptor, err := EncryptorWithPassword(password, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	padded := AddPKCS7Padding(plaintext)
+	encrypted := make([]byte, len(padded))
+	encryptor.CryptBlocks(encrypted, padded)
+
+	return encrypted, nil
+}
+
+// 创建基于密码的加密器
+func EncryptorWithPassword(password, salt []byte) (cipher.BlockMode, error) {
+	key, iv, err := CSENCPBKDF(password, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewCBCEncrypter(block, iv), nil
+}
+
+// 使用公钥加密
+func EncryptWithPublicKey(plaintext, publicKey []byte) ([]byte, error) {
+	pubKey, err := ParseRSAPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return rsa.EncryptOAEP(sha1.New(), rand.Reader, pubKey, plaintext, nil)
+}
+
+// 解析RSA公钥，支持PEM和DER编码的PKIX与PKCS1格式
+func ParseRSAPublicKey(publicKey []byte) (*rsa.PublicKey, error) {
+	der := publicKey
+	if block, _ := pem.Decode(publicKey); block != nil {
+		der = block.Bytes
+	}
+
+	if pubKey, err := x509.ParsePKCS1PublicKey(der); err == nil {
+		return pubKey, nil
+	}
+
+	pubKeyInterface, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %v", err)
+	}
+	pubKey, ok := pubKeyInterface.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("not an RSA public key")
+	}
+	return pubKey, nil
+}
+
 // 加盐哈希
 func SaltedHashOf(salt string, data []byte) string {
 	h := md5.New()
@@ -90,6 +90,21 @@ func TestStripPKCS7Padding(t *testing.T) {
 			input: append([]byte("test"), bytes.Repeat([]byte{byte(12)}, 12)...),
 			want:  []byte("test"),
 		},
+		{
+			name:  "AddPKCS7Padding round trip",
+			input: AddPKCS7Padding([]byte("hello world")),
+			want:  []byte("hello world"),
+		},
+		{
+			name:  "AddPKCS7Padding full block",
+			input: AddPKCS7Padding([]byte("0123456789abcdef")),
+			want:  []byte("0123456789abcdef"),
+		},
+		{
+			name:    "empty input",
+			input:   []byte{},
+			wantErr: true,
+		},
 		{
 			name:    "invalid length",
 			input:   []byte("invalid"),
@@ -184,18 +199,6 @@ func TestBase64Decode(t *testing.T) {
 	}
 }
 
-// 辅助函数：添加 PKCS7 填充
-func addPKCS7Padding(data []byte) []byte {
-	blockSize := 16
-	padding := blockSize - (len(data) % blockSize)
-	paddedData := make([]byte, len(data)+padding)
-	copy(paddedData, data)
-	for i := len(data); i < len(paddedData); i++ {
-		paddedData[i] = byte(padding)
-	}
-	return paddedData
-}
-
 // 集成测试：使用真实文件测试
 func TestRealFileDecryption(t *testing.T) {
 	// 测试文件路径
@@ -1,6 +1,8 @@
 package core
 
 import (
+	"context"
+	"crypto/aes"
 	"crypto/cipher"
 	"crypto/md5"
 	"encoding/base64"
@@ -9,6 +11,7 @@ import (
 	"fmt"
 	"hash"
 	"io"
+	"strings"
 
 	"github.com/synology-cloud-sync-decrypt-tool/syndecrypt-go/pkg/util"
 )
@@ -23,6 +26,41 @@ type DecryptConfig struct {
 	Password   []byte
 	PrivateKey []byte
 	PublicKey  []byte
+	// PrivateKeyPassphrase 用于解密口令保护的私钥
+	PrivateKeyPassphrase []byte
+	// NoVerify 为 true 时不校验 file_md5 摘要
+	NoVerify bool
+	// Credentials 是由同一配置预先构建的凭据缓存，批量解密时共享；
+	// 为 nil 时每个文件单独解析凭据
+	Credentials *Credentials
+	// Workers 单个文件内并行解密数据块的协程数，> 1 时以流水线方式解密，
+	// 否则在调用方协程中顺序解密
+	Workers int
+}
+
+// ErrIntegrity 表示解密结果未通过完整性校验
+var ErrIntegrity = errors.New("integrity check failed")
+
+// DigestMismatchError 记录 file_md5 与实际摘要不一致的详细信息
+type DigestMismatchError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *DigestMismatchError) Error() string {
+	return fmt.Sprintf("%v: file_md5 mismatch: expected %s, got %s", ErrIntegrity, e.Expected, e.Actual)
+}
+
+// Is 使 errors.Is(err, ErrIntegrity) 成立
+func (e *DigestMismatchError) Is(target error) bool {
+	return target == ErrIntegrity
+}
+
+// DigestResult 记录解密过程中的摘要校验情况
+type DigestResult struct {
+	Expected string // 文件元数据中的 file_md5
+	Actual   string // 解压后数据的实际 MD5
+	Verified bool   // 是否已比对且一致
 }
 
 // DecryptStream 从输入流解密到输出流
@@ -30,213 +68,434 @@ func DecryptStream(input io.Reader, output io.Writer, config DecryptConfig) erro
 	return DecryptStreamWithFilename(input, output, config, "")
 }
 
+// DecryptStreamContext 与 DecryptStream 相同，ctx 取消时停止解密并返回 ctx.Err()
+func DecryptStreamContext(ctx context.Context, input io.Reader, output io.Writer, config DecryptConfig) error {
+	_, err := DecryptStreamWithDigestContext(ctx, input, output, config, "")
+	return err
+}
+
 // DecryptStreamWithFilename 从输入流解密到输出流，包含文件名信息用于错误报告
 func DecryptStreamWithFilename(input io.Reader, output io.Writer, config DecryptConfig, filename string) error {
+	_, err := DecryptStreamWithDigest(input, output, config, filename)
+	return err
+}
+
+// DecryptStreamWithDigest 从输入流解密到输出流，并返回 file_md5 的校验结果
+func DecryptStreamWithDigest(input io.Reader, output io.Writer, config DecryptConfig, filename string) (DigestResult, error) {
+	return DecryptStreamWithDigestContext(context.Background(), input, output, config, filename)
+}
+
+// DecryptStreamWithDigestContext 与 DecryptStreamWithDigest 相同，ctx 取消时停止解密并返回 ctx.Err()
+func DecryptStreamWithDigestContext(ctx context.Context, input io.Reader, output io.Writer, config DecryptConfig, filename string) (DigestResult, error) {
+	var digest DigestResult
+	err := decryptStream(ctx, input, output, config, filename, &digest)
+	return digest, err
+}
+
+// streamMetadata 汇总流中的元数据，所有依赖多个字段的校验都在读完元数据后进行，
+// 不依赖字段出现的顺序
+type streamMetadata struct {
+	digest         string
+	encKey1        []byte
+	encKey2        []byte
+	key1Hash       string
+	salt           []byte
+	sessionKeyHash string
+	fileMD5        string
+}
+
+// apply 记录单个元数据字段，只做与其他字段无关的校验
+func (m *streamMetadata) apply(key string, value interface{}) error {
+	var err error
+
+	switch key {
+	case "digest":
+		if value != "md5" {
+			return fmt.Errorf("%w: unexpected digest: %v", ErrCorruptHeader, value)
+		}
+		m.digest = "md5"
+
+	case "enc_key1":
+		if str, ok := value.(string); ok {
+			m.encKey1, err = base64.StdEncoding.DecodeString(str)
+			if err != nil {
+				return fmt.Errorf("%w: failed to decode enc_key1: %v", ErrCorruptHeader, err)
+			}
+		}
+
+	case "enc_key2":
+		if str, ok := value.(string); ok {
+			m.encKey2, err = base64.StdEncoding.DecodeString(str)
+			if err != nil {
+				return fmt.Errorf("%w: failed to decode enc_key2: %v", ErrCorruptHeader, err)
+			}
+		}
+
+	case "key1_hash":
+		if str, ok := value.(string); ok {
+			m.key1Hash = str
+		}
+
+	case "salt":
+		if str, ok := value.(string); ok {
+			m.salt = []byte(str)
+		}
+
+	case "session_key_hash":
+		if str, ok := value.(string); ok {
+			m.sessionKeyHash = str
+		}
+
+	case "version":
+		if version, ok := value.(*OrderedDict); ok {
+			major, err := versionNumber(version, "major")
+			if err != nil {
+				return err
+			}
+			minor, err := versionNumber(version, "minor")
+			if err != nil {
+				return err
+			}
+
+			// 验证版本
+			if major != 1 && major != 3 {
+				return &UnsupportedVersionError{Major: major, Minor: minor}
+			}
+		}
+
+	case "file_md5":
+		if str, ok := value.(string); ok {
+			m.fileMD5 = str
+		}
+	}
+
+	return nil
+}
+
+// versionNumber 读取版本字典中的整数字段
+func versionNumber(version *OrderedDict, field string) (int, error) {
+	value, _ := version.Get(field)
+	switch v := value.(type) {
+	case int64:
+		return int(v), nil
+	case int:
+		return v, nil
+	default:
+		return 0, fmt.Errorf("%w: unexpected %s version type: %T", ErrCorruptHeader, field, v)
+	}
+}
+
+// checkPassword 使用 key1_hash 验证密码
+func (m *streamMetadata) checkPassword(password []byte) error {
+	if m.key1Hash == "" || len(m.key1Hash) < 10 {
+		return nil
+	}
+	if SaltedHashOf(m.key1Hash[:10], password) != m.key1Hash {
+		return fmt.Errorf("%w: password hash mismatch", ErrWrongPassword)
+	}
+	return nil
+}
+
+// sessionKey 根据配置解出会话密钥并验证 session_key_hash
+func (m *streamMetadata) sessionKey(config DecryptConfig) ([]byte, error) {
 	var sessionKey []byte
-	var decryptor Decryptor
-	var md5Digestor hash.Hash
-	var expectedMD5Digest string
-	var encKey1Bytes []byte
-	var encKey2Bytes []byte
-	var salt []byte
-	var sessionKeyHash string
+
+	// 派生会话密钥
+	if config.Password != nil && m.encKey1 != nil {
+		if err := m.checkPassword(config.Password); err != nil {
+			return nil, err
+		}
+		creds, err := config.credentials()
+		if err != nil {
+			return nil, err
+		}
+		sessionKey, err = creds.passwordSessionKey(m.encKey1, m.salt)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to decrypt session key with password: %v", ErrWrongPassword, err)
+		}
+	} else if config.PrivateKey != nil && m.encKey2 != nil {
+		// 构建凭据时已确认密钥对匹配，避免每个文件都得到难以理解的 OAEP 错误。
+		// key2_hash 的输入编码未公开，不用于检查；文件是用另一对密钥加密时，
+		// 只能通过 RSA-OAEP 解密失败发现，归类为 ErrWrongKey
+		creds, err := config.credentials()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load private key: %w", classify(ErrWrongKey, err))
+		}
+		sessionKey, err = creds.privateKeySessionKey(m.encKey2)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt session key with private key: %w", classify(ErrWrongKey, err))
+		}
+	}
+
+	if sessionKey == nil {
+		return nil, fmt.Errorf("%w: not enough information to decrypt data", credentialError(config))
+	}
+
+	// 验证会话密钥哈希
+	if m.sessionKeyHash != "" {
+		// 根据sessionKeyHash的长度确定salt长度
+		saltLen := len(m.sessionKeyHash)
+		if saltLen > 10 {
+			saltLen = 10
+		}
+		actualSessionKeyHash := SaltedHashOf(m.sessionKeyHash[:saltLen], sessionKey)
+		if m.sessionKeyHash != actualSessionKeyHash {
+			return nil, fmt.Errorf("%w: session key hash mismatch", credentialError(config))
+		}
+	}
+
+	return sessionKey, nil
+}
+
+// dataCipher 根据会话密钥派生数据块的 AES 密钥和初始 IV
+func (m *streamMetadata) dataCipher(sessionKey []byte) (cipher.Block, []byte, error) {
+	dataKey := sessionKey
+	if len(m.salt) > 0 {
+		// 如果salt不为空，尝试解码十六进制格式的sessionKey（静默处理）
+		sessionKeyHex := make([]byte, hex.DecodedLen(len(sessionKey)))
+		n, decodeErr := hex.Decode(sessionKeyHex, sessionKey)
+		if decodeErr == nil {
+			dataKey = sessionKeyHex[:n]
+		}
+		// 如果解码失败，直接使用原始sessionKey
+	}
+	// 如果没有salt，直接使用sessionKey（静默处理）
+
+	key, iv, err := CSENCPBKDF(dataKey, []byte{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create decryptor: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create decryptor: %v", err)
+	}
+	return block, iv, nil
+}
+
+func decryptStream(ctx context.Context, input io.Reader, output io.Writer, config DecryptConfig, filename string, digest *DigestResult) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	// 解码流
-	ch, err := DecodeCSEncStream(input)
+	decoder := NewStreamDecoder(input)
+	if err := decoder.ValidateHeader(); err != nil {
+		return fmt.Errorf("failed to decode stream: %w", err)
+	}
+
+	decrypter, err := newStreamDecrypter(output, config, filename, digest)
 	if err != nil {
-		return fmt.Errorf("failed to decode stream: %v", err)
+		return err
 	}
+	defer decrypter.close()
 
-	// 创建 LZ4 解压器
-	decompressor, err := util.NewLz4DecompressorWithFilename(func(decompressed []byte) {
-		output.Write(decompressed)
-		if md5Digestor != nil {
-			md5Digestor.Write(decompressed)
+	if config.Workers > 1 {
+		return decryptStreamPipelined(ctx, decoder, decrypter, config.Workers)
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		item, err := decoder.Next()
+		if err == io.EOF {
+			return decrypter.finish()
+		}
+		if err != nil {
+			return err
+		}
+		if err := decrypter.process(item); err != nil {
+			return err
 		}
-	}, filename)
+	}
+}
+
+// streamDecrypter 逐条处理解码后的流条目：解密、解压并写入输出，
+// DecryptStream、NewDecryptingReader 和流水线解密共用
+type streamDecrypter struct {
+	config DecryptConfig
+	meta   streamMetadata
+	// prepared 表示已根据元数据解出会话密钥
+	prepared     bool
+	block        cipher.Block
+	iv           []byte
+	decryptor    Decryptor
+	md5Digestor  hash.Hash
+	decompressor *util.Lz4Decompressor
+	output       io.Writer
+	// sink 接收解压后的数据，默认是 output 和摘要计算的组合
+	sink     io.Writer
+	writeErr error
+	// 上一个解密后的数据块，最后一块需要先去除填充才能解压
+	pendingChunk []byte
+	digest       *DigestResult
+}
+
+func newStreamDecrypter(output io.Writer, config DecryptConfig, filename string, digest *DigestResult) (*streamDecrypter, error) {
+	d := &streamDecrypter{config: config, output: output, sink: output, digest: digest}
+
+	// 创建 LZ4 解压器
+	decompressor, err := util.NewLz4DecompressorWithFilename(d.write, filename)
 	if err != nil {
-		return fmt.Errorf("failed to create decompressor: %v", err)
-	}
-	defer decompressor.Close()
-
-	var decryptedChunk []byte
-
-	for item := range ch {
-		if item.Error != nil {
-			return item.Error
-		}
-
-		if item.Key != "" {
-			// 静默处理，不再输出调试信息
-			switch item.Key {
-			case "digest":
-				if item.Value != "md5" {
-					return fmt.Errorf("unexpected digest: %v", item.Value)
-				}
-				md5Digestor = md5.New()
-
-			case "enc_key1":
-				if str, ok := item.Value.(string); ok {
-					encKey1Bytes, err = base64.StdEncoding.DecodeString(str)
-					if err != nil {
-						return fmt.Errorf("failed to decode enc_key1: %v", err)
-					}
-				}
-
-			case "enc_key2":
-				if str, ok := item.Value.(string); ok {
-					encKey2Bytes, err = base64.StdEncoding.DecodeString(str)
-					if err != nil {
-						return fmt.Errorf("failed to decode enc_key2: %v", err)
-					}
-				}
-
-			case "key1_hash":
-				if config.Password != nil && encKey1Bytes != nil {
-					actualPasswordHash := SaltedHashOf(item.Value.(string)[:10], config.Password)
-					if actualPasswordHash != item.Value.(string) {
-						return fmt.Errorf("password hash mismatch")
-					}
-				}
-
-			case "salt":
-				if str, ok := item.Value.(string); ok {
-					salt = []byte(str)
-					// 静默处理，不再输出调试信息
-				}
-
-			case "session_key_hash":
-				if str, ok := item.Value.(string); ok {
-					sessionKeyHash = str
-				}
-
-			case "version":
-				if version, ok := item.Value.(map[string]interface{}); ok {
-					var major, minor int
-					switch v := version["major"].(type) {
-					case int64:
-						major = int(v)
-					case int:
-						major = v
-					default:
-						return fmt.Errorf("unexpected major version type: %T", v)
-					}
-
-					switch v := version["minor"].(type) {
-					case int64:
-						minor = int(v)
-					case int:
-						minor = v
-					default:
-						return fmt.Errorf("unexpected minor version type: %T", v)
-					}
-
-					// 静默处理，不再输出调试信息
-
-					// 验证版本
-					if major != 1 && major != 3 {
-						return fmt.Errorf("unsupported version: %d.%d", major, minor)
-					}
-
-					// 静默处理，不再输出警告信息
-					if major > 1 && len(salt) == 0 {
-						// 不输出警告，继续处理
-					}
-				}
-
-			case "file_md5":
-				if str, ok := item.Value.(string); ok {
-					expectedMD5Digest = str
-				}
-			}
-		} else if item.Data != nil {
-			// 解密数据块
-			if decryptor == nil {
-				// 派生会话密钥
-				if config.Password != nil && encKey1Bytes != nil {
-					sessionKey, err = DecryptWithPassword(encKey1Bytes, config.Password, salt)
-					if err != nil {
-						return fmt.Errorf("failed to decrypt session key with password: %v", err)
-					}
-				} else if config.PrivateKey != nil && encKey2Bytes != nil {
-					sessionKey, err = DecryptWithPrivateKey(encKey2Bytes, config.PrivateKey)
-					if err != nil {
-						return fmt.Errorf("failed to decrypt session key with private key: %v", err)
-					}
-				}
-
-				if sessionKey == nil {
-					return errors.New("not enough information to decrypt data")
-				}
-
-				// 验证会话密钥哈希
-				if sessionKeyHash != "" {
-					// 根据sessionKeyHash的长度确定salt长度
-					saltLen := len(sessionKeyHash)
-					if saltLen > 10 {
-						saltLen = 10
-					}
-					if saltLen > 0 {
-						actualSessionKeyHash := SaltedHashOf(sessionKeyHash[:saltLen], sessionKey)
-						if sessionKeyHash != actualSessionKeyHash {
-							return errors.New("session key hash mismatch")
-						}
-					}
-				}
-
-				// 创建解密器
-				var blockMode cipher.BlockMode
-				if len(salt) > 0 {
-					// 如果salt不为空，尝试解码十六进制格式的sessionKey（静默处理）
-					sessionKeyHex := make([]byte, hex.DecodedLen(len(sessionKey)))
-					n, err := hex.Decode(sessionKeyHex, sessionKey)
-					if err != nil {
-						// 静默处理，如果解码失败，直接使用原始sessionKey
-						blockMode, err = DecryptorWithPassword(sessionKey, []byte{})
-					} else {
-						blockMode, err = DecryptorWithPassword(sessionKeyHex[:n], []byte{})
-					}
-				} else {
-					// 如果没有salt，直接使用sessionKey（静默处理）
-					blockMode, err = DecryptorWithPassword(sessionKey, []byte{})
-				}
-				if err != nil {
-					return fmt.Errorf("failed to create decryptor: %v", err)
-				}
-
-				// 包装成 Decryptor 接口
-				decryptor = &blockDecryptor{blockMode: blockMode}
-			}
+		return nil, fmt.Errorf("failed to create decompressor: %v", err)
+	}
+	d.decompressor = decompressor
+	return d, nil
+}
 
-			if decryptedChunk != nil {
-				decompressor.Write(decryptedChunk)
-			}
+// write 接收解压后的数据，写入 sink
+func (d *streamDecrypter) write(decompressed []byte) {
+	if d.writeErr != nil {
+		return
+	}
+	if _, err := d.sink.Write(decompressed); err != nil {
+		d.writeErr = fmt.Errorf("failed to write output: %w", err)
+	}
+}
+
+// decompress 向解压器写入数据并检查解压和输出错误
+func (d *streamDecrypter) decompress(data []byte) error {
+	if err := d.decompressor.Write(data); err != nil {
+		return classify(ErrDecompression, err)
+	}
+	return d.writeErr
+}
 
-			// 解密当前数据块
-			decryptedChunk = decryptor.Decrypt(item.Data)
+// prepare 在第一个数据块之前调用，此时元数据已经完整，解出会话密钥并准备摘要计算
+func (d *streamDecrypter) prepare() error {
+	sessionKey, err := d.meta.sessionKey(d.config)
+	if err != nil {
+		return err
+	}
+	d.block, d.iv, err = d.meta.dataCipher(sessionKey)
+	if err != nil {
+		return err
+	}
+	d.decryptor = &blockDecryptor{blockMode: cipher.NewCBCDecrypter(d.block, d.iv)}
+	if d.meta.digest == "md5" {
+		d.md5Digestor = md5.New()
+		d.sink = io.MultiWriter(d.output, d.md5Digestor)
+	}
+	d.prepared = true
+	return nil
+}
+
+// checkChunk 检查数据块长度是否为 AES 块大小的整数倍
+func checkChunk(data []byte) error {
+	if len(data) == 0 {
+		return fmt.Errorf("%w: empty data chunk", ErrCorruptStream)
+	}
+	if len(data)%aes.BlockSize != 0 {
+		return fmt.Errorf("%w: data chunk length %d is not a multiple of the block size", ErrCorruptStream, len(data))
+	}
+	return nil
+}
+
+// process 处理一个流条目
+func (d *streamDecrypter) process(item StreamItem) error {
+	if item.Error != nil {
+		return item.Error
+	}
+
+	if item.Key != "" {
+		return d.meta.apply(item.Key, item.Value)
+	}
+	if item.Data == nil {
+		return nil
+	}
+
+	if !d.prepared {
+		if err := d.prepare(); err != nil {
+			return err
+		}
+	}
+	if err := checkChunk(item.Data); err != nil {
+		return err
+	}
+
+	// 解密当前数据块
+	return d.accept(d.decryptor.Decrypt(item.Data))
+}
+
+// accept 接收按顺序解密后的数据块，解压上一块并保留当前块
+func (d *streamDecrypter) accept(plaintext []byte) error {
+	if d.pendingChunk != nil {
+		if err := d.decompress(d.pendingChunk); err != nil {
+			return err
 		}
 	}
+	d.pendingChunk = plaintext
+	return nil
+}
+
+// finish 在流结束后处理最后一块数据并校验摘要
+func (d *streamDecrypter) finish() error {
+	if err := d.finishDecompress(); err != nil {
+		return err
+	}
+	return d.verifyDigest()
+}
+
+// finishDecompress 去除最后一块的填充并确认 LZ4 帧完整结束
+func (d *streamDecrypter) finishDecompress() error {
+	meta := &d.meta
 
 	// 处理最后一块数据
-	if decryptedChunk != nil {
-		padded, err := StripPKCS7Padding(decryptedChunk)
+	if d.pendingChunk != nil {
+		padded, err := StripPKCS7Padding(d.pendingChunk)
 		if err != nil {
-			return fmt.Errorf("failed to strip padding: %v", err)
+			// 缺少末尾元数据时，最后一块不完整多半是文件被截断
+			kind := ErrIntegrity
+			if meta.fileMD5 == "" {
+				kind = ErrTruncated
+			}
+			return fmt.Errorf("%w: failed to strip padding: %v", kind, err)
+		}
+		d.pendingChunk = nil
+		if err := d.decompress(padded); err != nil {
+			return err
 		}
-		decompressor.Write(padded)
 	}
 
-	// 验证 MD5 摘要 (静默跳过不匹配，因为可能存在实现差异)
-	if md5Digestor != nil && expectedMD5Digest != "" {
-		actualMD5Digest := hex.EncodeToString(md5Digestor.Sum(nil))
-		if actualMD5Digest != expectedMD5Digest {
-			// 静默处理，不输出警告，继续解密过程
+	// 没有任何数据块也没有末尾元数据，说明文件在元数据之后被截断
+	if !d.prepared && meta.fileMD5 == "" {
+		return fmt.Errorf("%w: stream contains no data", ErrTruncated)
+	}
+
+	// 确认 LZ4 帧已完整结束
+	if err := d.decompressor.Close(); err != nil {
+		if errors.Is(err, util.ErrLz4Truncated) {
+			return classify(ErrTruncated, err)
 		}
+		return classify(ErrDecompression, err)
+	}
+	return d.writeErr
+}
+
+// verifyDigest 比对 file_md5 与实际摘要
+func (d *streamDecrypter) verifyDigest() error {
+	meta := &d.meta
+
+	d.digest.Expected = meta.fileMD5
+	if d.md5Digestor != nil {
+		d.digest.Actual = hex.EncodeToString(d.md5Digestor.Sum(nil))
+	}
+	if !d.config.NoVerify && d.md5Digestor != nil && meta.fileMD5 != "" {
+		if !strings.EqualFold(d.digest.Actual, meta.fileMD5) {
+			return &DigestMismatchError{Expected: meta.fileMD5, Actual: d.digest.Actual}
+		}
+		d.digest.Verified = true
 	}
 
 	return nil
 }
 
+// close 释放解压器
+func (d *streamDecrypter) close() {
+	d.decompressor.Close()
+}
+
 // blockDecryptor 实现 Decryptor 接口
 type blockDecryptor struct {
 	blockMode cipher.BlockMode
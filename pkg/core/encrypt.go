@@ -0,0 +1,203 @@
+package core
+
+import (
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/synology-cloud-sync-decrypt-tool/syndecrypt-go/pkg/util"
+)
+
+const (
+	// 每个数据块的密文长度，必须是 AES 块大小的整数倍且不超过 65535
+	encryptChunkSize = 32768
+	// 加盐哈希和密钥派生使用的盐长度
+	encryptSaltLength = 10
+	// 会话密钥的原始字节长度，写入文件时使用十六进制编码
+	sessionKeyLength = 32
+)
+
+// EncryptConfig 保存加密配置，Password 和 PublicKey 至少提供一个
+type EncryptConfig struct {
+	Password  []byte
+	PublicKey []byte
+	// Salt 为 enc_key1 派生密钥使用的盐，为空时随机生成
+	Salt string
+}
+
+// EncryptStream 将输入流加密为 Cloud Sync 兼容的 CSEnc 格式
+func EncryptStream(input io.Reader, output io.Writer, config EncryptConfig) error {
+	if config.Password == nil && config.PublicKey == nil {
+		return errors.New("either password or public key must be provided")
+	}
+
+	// 生成会话密钥，文件中保存的是其十六进制形式
+	rawSessionKey := make([]byte, sessionKeyLength)
+	if _, err := rand.Read(rawSessionKey); err != nil {
+		return fmt.Errorf("failed to generate session key: %v", err)
+	}
+	sessionKey := []byte(hex.EncodeToString(rawSessionKey))
+
+	salt := config.Salt
+	if salt == "" {
+		var err error
+		if salt, err = randomSalt(); err != nil {
+			return err
+		}
+	}
+
+	metadata, err := encryptionMetadata(config, sessionKey, salt)
+	if err != nil {
+		return err
+	}
+
+	encoder := NewStreamEncoder(output)
+	if err := encoder.WriteHeader(); err != nil {
+		return fmt.Errorf("failed to write header: %v", err)
+	}
+	if err := encoder.WriteObject(metadata); err != nil {
+		return fmt.Errorf("failed to write metadata: %v", err)
+	}
+
+	// 数据密钥由会话密钥通过无盐 KDF 派生，与解密端一致
+	blockMode, err := EncryptorWithPassword(rawSessionKey, []byte{})
+	if err != nil {
+		return fmt.Errorf("failed to create encryptor: %v", err)
+	}
+
+	chunks := &chunkEncryptor{encoder: encoder, blockMode: blockMode}
+	compressor := util.NewLz4Compressor(chunks)
+	md5Digestor := md5.New()
+
+	if _, err := io.Copy(compressor, io.TeeReader(input, md5Digestor)); err != nil {
+		return fmt.Errorf("failed to encrypt data: %v", err)
+	}
+	if err := compressor.Close(); err != nil {
+		return fmt.Errorf("failed to finish compression: %v", err)
+	}
+	if err := chunks.Close(); err != nil {
+		return fmt.Errorf("failed to encrypt data: %v", err)
+	}
+
+	// 文件末尾的元数据记录明文 MD5
+	trailer := NewOrderedDict()
+	trailer.Set("type", "metadata")
+	trailer.Set("file_md5", hex.EncodeToString(md5Digestor.Sum(nil)))
+	if err := encoder.WriteObject(trailer); err != nil {
+		return fmt.Errorf("failed to write metadata: %v", err)
+	}
+
+	return nil
+}
+
+// encryptionMetadata 生成文件头部的元数据字典
+func encryptionMetadata(config EncryptConfig, sessionKey []byte, salt string) (*OrderedDict, error) {
+	version := NewOrderedDict()
+	version.Set("major", 3)
+	version.Set("minor", 1)
+
+	metadata := NewOrderedDict()
+	metadata.Set("type", "metadata")
+	metadata.Set("version", version)
+	metadata.Set("compress", 1)
+	metadata.Set("encrypt", 1)
+	metadata.Set("digest", "md5")
+	metadata.Set("salt", salt)
+
+	if config.Password != nil {
+		encKey1, err := EncryptWithPassword(sessionKey, config.Password, []byte(salt))
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt session key with password: %v", err)
+		}
+		metadata.Set("enc_key1", base64.StdEncoding.EncodeToString(encKey1))
+	}
+
+	if config.PublicKey != nil {
+		encKey2, err := EncryptWithPublicKey(sessionKey, config.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt session key with public key: %v", err)
+		}
+		metadata.Set("enc_key2", base64.StdEncoding.EncodeToString(encKey2))
+	}
+
+	if config.Password != nil {
+		hashSalt, err := randomSalt()
+		if err != nil {
+			return nil, err
+		}
+		metadata.Set("key1_hash", SaltedHashOf(hashSalt, config.Password))
+	}
+
+	hashSalt, err := randomSalt()
+	if err != nil {
+		return nil, err
+	}
+	metadata.Set("session_key_hash", SaltedHashOf(hashSalt, sessionKey))
+
+	return metadata, nil
+}
+
+// randomSalt 生成由字母和数字组成的随机盐
+func randomSalt() (string, error) {
+	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+	buf := make([]byte, encryptSaltLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %v", err)
+	}
+	for i := range buf {
+		buf[i] = alphabet[int(buf[i])%len(alphabet)]
+	}
+	return string(buf), nil
+}
+
+// chunkEncryptor 接收压缩数据，按固定大小加密后写成数据块对象
+type chunkEncryptor struct {
+	encoder   *StreamEncoder
+	blockMode cipher.BlockMode
+	buffer    []byte
+}
+
+func (ce *chunkEncryptor) Write(data []byte) (int, error) {
+	ce.buffer = append(ce.buffer, data...)
+	for len(ce.buffer) >= encryptChunkSize {
+		if err := ce.writeChunk(ce.buffer[:encryptChunkSize]); err != nil {
+			return 0, err
+		}
+		ce.buffer = ce.buffer[encryptChunkSize:]
+	}
+	return len(data), nil
+}
+
+// Close 为剩余数据添加 PKCS7 填充并写出最后的数据块
+func (ce *chunkEncryptor) Close() error {
+	padded := AddPKCS7Padding(ce.buffer)
+	ce.buffer = nil
+
+	for len(padded) > 0 {
+		n := len(padded)
+		if n > encryptChunkSize {
+			n = encryptChunkSize
+		}
+		if err := ce.writeChunk(padded[:n]); err != nil {
+			return err
+		}
+		padded = padded[n:]
+	}
+	return nil
+}
+
+func (ce *chunkEncryptor) writeChunk(plaintext []byte) error {
+	ciphertext := make([]byte, len(plaintext))
+	ce.blockMode.CryptBlocks(ciphertext, plaintext)
+
+	chunk := NewOrderedDict()
+	chunk.Set("type", "data")
+	chunk.Set("data", ciphertext)
+	return ce.encoder.WriteObject(chunk)
+}
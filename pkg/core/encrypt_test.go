@@ -0,0 +1,200 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"testing"
+)
+
+// 测试辅助函数：加密一段数据
+func encryptTestData(t *testing.T, plaintext []byte, config EncryptConfig) []byte {
+	t.Helper()
+
+	var encrypted bytes.Buffer
+	if err := EncryptStream(bytes.NewReader(plaintext), &encrypted, config); err != nil {
+		t.Fatalf("EncryptStream() error = %v", err)
+	}
+	return encrypted.Bytes()
+}
+
+func TestEncryptStreamRoundTrip(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey() error = %v", err)
+	}
+	privateKeyDER := x509.MarshalPKCS1PrivateKey(privateKey)
+
+	password := []byte("testpassword")
+	plaintext := bytes.Repeat([]byte("Synology Cloud Sync round trip "), 10000)
+	encrypted := encryptTestData(t, plaintext, EncryptConfig{Password: password, PublicKey: publicKeyDER})
+
+	tests := []struct {
+		name   string
+		config DecryptConfig
+	}{
+		{"password", DecryptConfig{Password: password}},
+		{"private key", DecryptConfig{PrivateKey: privateKeyDER}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var decrypted bytes.Buffer
+			digest, err := DecryptStreamWithDigest(bytes.NewReader(encrypted), &decrypted, tt.config, "")
+			if err != nil {
+				t.Fatalf("DecryptStreamWithDigest() error = %v", err)
+			}
+			if !bytes.Equal(decrypted.Bytes(), plaintext) {
+				t.Errorf("decrypted %d bytes, want %d", decrypted.Len(), len(plaintext))
+			}
+			if !digest.Verified {
+				t.Error("file_md5 was not verified")
+			}
+		})
+	}
+}
+
+func TestEncryptStreamEmptyInput(t *testing.T) {
+	password := []byte("testpassword")
+	encrypted := encryptTestData(t, nil, EncryptConfig{Password: password})
+
+	var decrypted bytes.Buffer
+	if err := DecryptStream(bytes.NewReader(encrypted), &decrypted, DecryptConfig{Password: password}); err != nil {
+		t.Fatalf("DecryptStream() error = %v", err)
+	}
+	if decrypted.Len() != 0 {
+		t.Errorf("decrypted %d bytes, want 0", decrypted.Len())
+	}
+}
+
+func TestDecryptStreamDetectsDigestMismatch(t *testing.T) {
+	password := []byte("testpassword")
+	encrypted := encryptTestData(t, []byte("integrity"), EncryptConfig{Password: password})
+
+	// 篡改末尾元数据中的 file_md5
+	i := bytes.LastIndex(encrypted, []byte("file_md5"))
+	if i < 0 {
+		t.Fatal("file_md5 not found in encrypted stream")
+	}
+	tampered := append([]byte{}, encrypted...)
+	valueStart := i + len("file_md5") + 3
+	if tampered[valueStart] == '0' {
+		tampered[valueStart] = '1'
+	} else {
+		tampered[valueStart] = '0'
+	}
+
+	var decrypted bytes.Buffer
+	err := DecryptStream(bytes.NewReader(tampered), &decrypted, DecryptConfig{Password: password})
+	if !errors.Is(err, ErrIntegrity) {
+		t.Fatalf("DecryptStream() error = %v, want ErrIntegrity", err)
+	}
+
+	// NoVerify 跳过校验
+	decrypted.Reset()
+	err = DecryptStream(bytes.NewReader(tampered), &decrypted, DecryptConfig{Password: password, NoVerify: true})
+	if err != nil {
+		t.Fatalf("DecryptStream() with NoVerify error = %v", err)
+	}
+}
+
+func TestDecryptStreamWrongPassword(t *testing.T) {
+	encrypted := encryptTestData(t, []byte("secret"), EncryptConfig{Password: []byte("right")})
+
+	var decrypted bytes.Buffer
+	if err := DecryptStream(bytes.NewReader(encrypted), &decrypted, DecryptConfig{Password: []byte("wrong")}); err == nil {
+		t.Fatal("DecryptStream() with wrong password should fail")
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	plaintext := make([]byte, 200000)
+	rand.Read(plaintext)
+	encrypted := encryptTestData(t, plaintext, EncryptConfig{Password: []byte("right")})
+
+	if err := CheckPassword(bytes.NewReader(encrypted), []byte("right")); err != nil {
+		t.Errorf("CheckPassword() with right password error = %v", err)
+	}
+	if err := CheckPassword(bytes.NewReader(encrypted), []byte("wrong")); err == nil {
+		t.Error("CheckPassword() with wrong password should fail")
+	}
+
+	// 只需要头部和第一个数据块：截断其余数据后仍可验证
+	header := encrypted[:bytes.Index(encrypted, []byte("\x10\x00\x04data"))+encryptChunkSize+64]
+	if err := CheckPassword(bytes.NewReader(header), []byte("right")); err != nil {
+		t.Errorf("CheckPassword() on header only error = %v", err)
+	}
+}
+
+func TestDecryptStreamKeyPairMismatch(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	publicKeyDER := x509.MarshalPKCS1PublicKey(&privateKey.PublicKey)
+	otherPublicKeyDER := x509.MarshalPKCS1PublicKey(&otherKey.PublicKey)
+
+	encrypted := encryptTestData(t, []byte("pair"), EncryptConfig{PublicKey: publicKeyDER})
+
+	config := DecryptConfig{PrivateKey: x509.MarshalPKCS1PrivateKey(privateKey), PublicKey: otherPublicKeyDER}
+	var decrypted bytes.Buffer
+	err = DecryptStream(bytes.NewReader(encrypted), &decrypted, config)
+	if !errors.Is(err, ErrKeyMismatch) {
+		t.Fatalf("DecryptStream() error = %v, want ErrKeyMismatch", err)
+	}
+
+	// 文件是用另一对密钥加密时，RSA-OAEP 解密失败归类为 ErrWrongKey
+	otherConfig := DecryptConfig{PrivateKey: x509.MarshalPKCS1PrivateKey(otherKey), PublicKey: otherPublicKeyDER}
+	err = DecryptStream(bytes.NewReader(encrypted), &bytes.Buffer{}, otherConfig)
+	if !errors.Is(err, ErrWrongKey) {
+		t.Errorf("DecryptStream() error = %v, want ErrWrongKey", err)
+	}
+}
+
+// cancelWriter 在第一次写入时取消 context
+type cancelWriter struct {
+	cancel  context.CancelFunc
+	written int
+}
+
+func (w *cancelWriter) Write(p []byte) (int, error) {
+	w.cancel()
+	w.written += len(p)
+	return len(p), nil
+}
+
+func TestDecryptStreamContextCancel(t *testing.T) {
+	password := []byte("testpassword")
+	plaintext := make([]byte, 500000)
+	rand.Read(plaintext)
+	encrypted := encryptTestData(t, plaintext, EncryptConfig{Password: password})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := DecryptStreamContext(ctx, bytes.NewReader(encrypted), &bytes.Buffer{}, DecryptConfig{Password: password}); !errors.Is(err, context.Canceled) {
+		t.Errorf("DecryptStreamContext() with canceled context error = %v, want context.Canceled", err)
+	}
+
+	// 解密过程中取消
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	writer := &cancelWriter{cancel: cancel}
+	err := DecryptStreamContext(ctx, bytes.NewReader(encrypted), writer, DecryptConfig{Password: password})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("DecryptStreamContext() error = %v, want context.Canceled", err)
+	}
+	if writer.written >= len(plaintext) {
+		t.Errorf("wrote %d bytes after cancellation, want fewer than %d", writer.written, len(plaintext))
+	}
+}
@@ -0,0 +1,75 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 解密过程中可能出现的错误类别，可以穿过 files 包的包装用 errors.Is 判断。
+// 完整性错误见 ErrIntegrity，密钥对不匹配见 ErrKeyMismatch，
+// 私钥口令错误见 ErrPassphraseRequired 和 ErrIncorrectPassphrase
+var (
+	// ErrWrongPassword 表示密码错误
+	ErrWrongPassword = errors.New("wrong password")
+	// ErrWrongKey 表示私钥无法解出会话密钥
+	ErrWrongKey = errors.New("wrong private key")
+	// ErrCorruptHeader 表示魔数头或元数据损坏
+	ErrCorruptHeader = errors.New("corrupt header")
+	// ErrCorruptStream 表示数据部分的对象编码损坏
+	ErrCorruptStream = errors.New("corrupt stream")
+	// ErrTruncated 表示文件在结束前被截断
+	ErrTruncated = errors.New("truncated stream")
+	// ErrUnsupportedVersion 表示文件格式版本不受支持
+	ErrUnsupportedVersion = errors.New("unsupported version")
+	// ErrDecompression 表示 LZ4 解压失败
+	ErrDecompression = errors.New("decompression failed")
+)
+
+// UnsupportedVersionError 记录不受支持的格式版本号
+type UnsupportedVersionError struct {
+	Major int
+	Minor int
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("%v: %d.%d", ErrUnsupportedVersion, e.Major, e.Minor)
+}
+
+// Is 使 errors.Is(err, ErrUnsupportedVersion) 成立
+func (e *UnsupportedVersionError) Is(target error) bool {
+	return target == ErrUnsupportedVersion
+}
+
+// classifiedError 给底层错误附加类别，错误信息保持不变
+type classifiedError struct {
+	kind error
+	err  error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Is(target error) bool {
+	return target == e.kind
+}
+
+func (e *classifiedError) Unwrap() error {
+	return e.err
+}
+
+// classify 将 err 归入 kind 类别；已经属于该类别的错误原样返回
+func classify(kind, err error) error {
+	if err == nil || errors.Is(err, kind) {
+		return err
+	}
+	return &classifiedError{kind: kind, err: err}
+}
+
+// credentialError 根据使用的凭据返回对应的错误类别
+func credentialError(config DecryptConfig) error {
+	if config.Password == nil && config.PrivateKey != nil {
+		return ErrWrongKey
+	}
+	return ErrWrongPassword
+}
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestDecryptStreamErrorKinds(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	publicKeyDER := x509.MarshalPKCS1PublicKey(&privateKey.PublicKey)
+
+	password := []byte("testpassword")
+	plaintext := make([]byte, 100000)
+	rand.Read(plaintext)
+	encrypted := encryptTestData(t, plaintext, EncryptConfig{Password: password, PublicKey: publicKeyDER})
+
+	// 修改副本中的若干字节
+	patch := func(offset int, data []byte) []byte {
+		patched := append([]byte{}, encrypted...)
+		copy(patched[offset:], data)
+		return patched
+	}
+	versionOffset := bytes.Index(encrypted, []byte("major\x01\x01\x03")) + len("major\x01\x01")
+	dataDict := bytes.Index(encrypted, []byte("\x42\x10\x00\x04type\x10\x00\x04data"))
+	firstChunk := bytes.Index(encrypted, []byte("\x10\x00\x04data\x11")) + len("\x10\x00\x04data\x11") + 2
+	trailer := bytes.LastIndex(encrypted, []byte("\x42\x10\x00\x04type\x10\x00\x08metadata"))
+
+	// 在 offset 处插入一个 data 为空的数据块
+	insertEmptyChunk := func(offset int) []byte {
+		chunk := NewOrderedDict()
+		chunk.Set("type", "data")
+		chunk.Set("data", []byte{})
+		var encoded bytes.Buffer
+		if err := NewStreamEncoder(&encoded).WriteObject(chunk); err != nil {
+			t.Fatalf("WriteObject() error = %v", err)
+		}
+		patched := append([]byte{}, encrypted[:offset]...)
+		patched = append(patched, encoded.Bytes()...)
+		return append(patched, encrypted[offset:]...)
+	}
+
+	tests := []struct {
+		name   string
+		input  []byte
+		config DecryptConfig
+		want   error
+	}{
+		{"wrong password", encrypted, DecryptConfig{Password: []byte("wrong")}, ErrWrongPassword},
+		{"wrong key", encrypted, DecryptConfig{PrivateKey: x509.MarshalPKCS1PrivateKey(otherKey)}, ErrWrongKey},
+		{"corrupt header", patch(0, []byte("__NOT_CLOUDSYNC__")), DecryptConfig{Password: password}, ErrCorruptHeader},
+		{"empty input", nil, DecryptConfig{Password: password}, ErrCorruptHeader},
+		{"truncated in data", encrypted[:len(encrypted)/2], DecryptConfig{Password: password}, ErrTruncated},
+		{"truncated in trailer", encrypted[:len(encrypted)-5], DecryptConfig{Password: password}, ErrTruncated},
+		{"truncated before data", encrypted[:dataDict], DecryptConfig{Password: password}, ErrTruncated},
+		{"truncated in data dict", encrypted[:dataDict+5], DecryptConfig{Password: password}, ErrTruncated},
+		{"unsupported version", patch(versionOffset, []byte{9}), DecryptConfig{Password: password}, ErrUnsupportedVersion},
+		{"empty first chunk", insertEmptyChunk(dataDict), DecryptConfig{Password: password}, ErrCorruptStream},
+		{"empty last chunk", insertEmptyChunk(trailer), DecryptConfig{Password: password}, ErrCorruptStream},
+		{"corrupt data", patch(firstChunk+1000, []byte{0xFF, 0xFF, 0xFF, 0xFF}), DecryptConfig{Password: password}, ErrDecompression},
+	}
+
+	for _, tt := range tests {
+		// 顺序解密和流水线解密返回相同类别的错误
+		for _, workers := range []int{0, 4} {
+			t.Run(fmt.Sprintf("%s/workers=%d", tt.name, workers), func(t *testing.T) {
+				config := tt.config
+				config.Workers = workers
+				var decrypted bytes.Buffer
+				err := DecryptStream(bytes.NewReader(tt.input), &decrypted, config)
+				if !errors.Is(err, tt.want) {
+					t.Fatalf("DecryptStream() error = %v, want %v", err, tt.want)
+				}
+			})
+		}
+	}
+
+	var versionErr *UnsupportedVersionError
+	err = DecryptStream(bytes.NewReader(patch(versionOffset, []byte{9})), &bytes.Buffer{}, DecryptConfig{Password: password})
+	if !errors.As(err, &versionErr) || versionErr.Major != 9 {
+		t.Errorf("DecryptStream() error = %v, want UnsupportedVersionError for 9.x", err)
+	}
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"fmt"
+	"io"
+)
+
+// FileInfo 加密文件的头部信息，读取时不需要密码或私钥
+type FileInfo struct {
+	VersionMajor   int    `json:"version_major"`
+	VersionMinor   int    `json:"version_minor"`
+	HasEncKey1     bool   `json:"has_enc_key1"`
+	HasEncKey2     bool   `json:"has_enc_key2"`
+	Salt           string `json:"salt,omitempty"`
+	Key1Hash       string `json:"key1_hash,omitempty"`
+	Key2Hash       string `json:"key2_hash,omitempty"`
+	SessionKeyHash string `json:"session_key_hash,omitempty"`
+	Digest         string `json:"digest,omitempty"`
+	FileMD5        string `json:"file_md5,omitempty"`
+	ChunkCount     int    `json:"chunk_count"`
+	CiphertextSize int64  `json:"ciphertext_size"`
+}
+
+// InspectStream 读取整个加密流，汇总元数据和数据块统计，不解密任何数据
+func InspectStream(reader io.Reader) (*FileInfo, error) {
+	decoder := NewStreamDecoder(reader)
+	if err := decoder.ValidateHeader(); err != nil {
+		return nil, err
+	}
+
+	info := &FileInfo{}
+	for {
+		item, err := decoder.Next()
+		if err == io.EOF {
+			return info, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if item.Key != "" {
+			if err := info.apply(item.Key, item.Value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if item.Data != nil {
+			info.ChunkCount++
+			info.CiphertextSize += int64(len(item.Data))
+		}
+	}
+}
+
+// apply 记录一个元数据字段
+func (info *FileInfo) apply(key string, value interface{}) error {
+	str, _ := value.(string)
+
+	switch key {
+	case "version":
+		version, ok := value.(*OrderedDict)
+		if !ok {
+			return fmt.Errorf("%w: unexpected version type: %T", ErrCorruptHeader, value)
+		}
+		major, err := versionNumber(version, "major")
+		if err != nil {
+			return err
+		}
+		minor, err := versionNumber(version, "minor")
+		if err != nil {
+			return err
+		}
+		info.VersionMajor, info.VersionMinor = major, minor
+	case "enc_key1":
+		info.HasEncKey1 = str != ""
+	case "enc_key2":
+		info.HasEncKey2 = str != ""
+	case "salt":
+		info.Salt = str
+	case "key1_hash":
+		info.Key1Hash = str
+	case "key2_hash":
+		info.Key2Hash = str
+	case "session_key_hash":
+		info.SessionKeyHash = str
+	case "digest":
+		info.Digest = str
+	case "file_md5":
+		info.FileMD5 = str
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package core
+
+// OrderedDict 保持键的写入顺序，对应 CSEnc 格式中的 OrderedDict
+type OrderedDict struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// NewOrderedDict 创建空的有序字典
+func NewOrderedDict() *OrderedDict {
+	return &OrderedDict{values: make(map[string]interface{})}
+}
+
+// Set 设置键值，新键追加到末尾，已有键保持原位置
+func (d *OrderedDict) Set(key string, value interface{}) {
+	if _, ok := d.values[key]; !ok {
+		d.keys = append(d.keys, key)
+	}
+	d.values[key] = value
+}
+
+// Get 获取键对应的值
+func (d *OrderedDict) Get(key string) (interface{}, bool) {
+	value, ok := d.values[key]
+	return value, ok
+}
+
+// Keys 按写入顺序返回所有键
+func (d *OrderedDict) Keys() []string {
+	keys := make([]string, len(d.keys))
+	copy(keys, d.keys)
+	return keys
+}
+
+// Len 返回键的数量
+func (d *OrderedDict) Len() int {
+	return len(d.keys)
+}
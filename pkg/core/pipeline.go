@@ -0,0 +1,219 @@
+package core
+
+import (
+	"context"
+	"crypto/cipher"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// pipelineChunk 流水线中的一个数据块。每块的 IV 是上一块密文的最后一个 AES 块，
+// 因此各块可以独立并行解密
+type pipelineChunk struct {
+	ciphertext []byte
+	iv         []byte
+	plaintext  []byte
+	// done 在 plaintext 就绪后关闭
+	done chan struct{}
+}
+
+// pipelineError 记录流水线中第一个出错的阶段并取消其余阶段
+type pipelineError struct {
+	once   sync.Once
+	err    error
+	cancel context.CancelFunc
+}
+
+func (e *pipelineError) set(err error) {
+	e.once.Do(func() {
+		e.err = err
+		e.cancel()
+	})
+}
+
+// pipelineWriter 把解压后的数据复制后交给写入阶段，写入阶段出错后立即返回错误
+type pipelineWriter struct {
+	ctx    context.Context
+	writes chan<- []byte
+
+	mu  sync.Mutex
+	err error
+}
+
+func (w *pipelineWriter) Write(p []byte) (int, error) {
+	if err := w.writeErr(); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, len(p))
+	copy(buf, p)
+	select {
+	case w.writes <- buf:
+		return len(p), nil
+	case <-w.ctx.Done():
+		if err := w.writeErr(); err != nil {
+			return 0, err
+		}
+		return 0, w.ctx.Err()
+	}
+}
+
+func (w *pipelineWriter) writeErr() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+func (w *pipelineWriter) setWriteErr(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.err = err
+}
+
+// decryptStreamPipelined 以四个阶段解密：
+//  1. 当前协程读取并解析流，记录元数据，为每个数据块计算 IV
+//  2. workers 个协程并行 CBC 解密数据块
+//  3. 一个协程按原顺序解压
+//  4. 一个协程计算摘要并写入输出
+//
+// 阶段之间的通道都有界，同时在途的数据块不超过 2*workers 个
+func decryptStreamPipelined(ctx context.Context, decoder *StreamDecoder, d *streamDecrypter, workers int) error {
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	pipeErr := &pipelineError{cancel: cancel}
+
+	chunks := make(chan *pipelineChunk, workers)
+	ordered := make(chan *pipelineChunk, 2*workers)
+	writes := make(chan []byte, 2*workers)
+	writer := &pipelineWriter{ctx: ctx, writes: writes}
+
+	// 阶段 2：并行解密
+	var decrypting sync.WaitGroup
+	var block cipher.Block
+	for i := 0; i < workers; i++ {
+		decrypting.Add(1)
+		go func() {
+			defer decrypting.Done()
+			for chunk := range chunks {
+				chunk.plaintext = make([]byte, len(chunk.ciphertext))
+				cipher.NewCBCDecrypter(block, chunk.iv).CryptBlocks(chunk.plaintext, chunk.ciphertext)
+				close(chunk.done)
+			}
+		}()
+	}
+
+	// 阶段 3：按顺序解压，出错后继续消费剩余数据块
+	decompressed := make(chan struct{})
+	go func() {
+		defer close(decompressed)
+		for chunk := range ordered {
+			<-chunk.done
+			if ctx.Err() != nil {
+				continue
+			}
+			if err := d.accept(chunk.plaintext); err != nil {
+				pipeErr.set(err)
+			}
+		}
+	}()
+
+	// 阶段 4：计算摘要并写入输出，出错后继续消费剩余数据
+	var target io.Writer
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		for buf := range writes {
+			if writer.writeErr() != nil {
+				continue
+			}
+			if _, err := target.Write(buf); err != nil {
+				writer.setWriteErr(err)
+				cancel()
+			}
+		}
+	}()
+
+	// 阶段 1：解析
+	var iv []byte
+	parse := func() error {
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			item, err := decoder.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if item.Key != "" {
+				if err := d.meta.apply(item.Key, item.Value); err != nil {
+					return err
+				}
+				continue
+			}
+			if item.Data == nil {
+				continue
+			}
+
+			if !d.prepared {
+				if err := d.prepare(); err != nil {
+					return err
+				}
+				// 之后解压出的数据交给写入阶段
+				block, iv = d.block, d.iv
+				target, d.sink = d.sink, writer
+			}
+			if err := checkChunk(item.Data); err != nil {
+				return err
+			}
+
+			chunk := &pipelineChunk{ciphertext: item.Data, iv: iv, done: make(chan struct{})}
+			iv = item.Data[len(item.Data)-len(iv):]
+
+			select {
+			case chunks <- chunk:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			select {
+			case ordered <- chunk:
+			case <-ctx.Done():
+				// 已交给解密阶段的数据块仍会完成，无需等待
+				return ctx.Err()
+			}
+		}
+	}
+	if err := parse(); err != nil {
+		pipeErr.set(err)
+	}
+
+	close(chunks)
+	close(ordered)
+	decrypting.Wait()
+	<-decompressed
+
+	if ctx.Err() == nil {
+		if err := d.finishDecompress(); err != nil {
+			pipeErr.set(err)
+		}
+	}
+	close(writes)
+	<-written
+
+	// 写入阶段的错误优先，其他阶段随后得到的只是取消
+	if err := writer.writeErr(); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	if err := parent.Err(); err != nil {
+		return err
+	}
+	if pipeErr.err != nil {
+		return pipeErr.err
+	}
+	return d.verifyDigest()
+}
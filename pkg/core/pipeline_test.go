@@ -0,0 +1,81 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// failingWriter 写入指定字节数后返回错误
+type failingWriter struct {
+	limit   int
+	written int
+}
+
+var errTestWrite = errors.New("disk full")
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.written+len(p) > w.limit {
+		return 0, errTestWrite
+	}
+	w.written += len(p)
+	return len(p), nil
+}
+
+func TestDecryptStreamPipelined(t *testing.T) {
+	password := []byte("testpassword")
+	random := make([]byte, 1<<20)
+	rand.Read(random)
+
+	inputs := map[string][]byte{
+		"random":       random,
+		"compressible": bytes.Repeat([]byte("pipelined decryption "), 100000),
+		"single chunk": []byte("small"),
+		"empty":        nil,
+	}
+
+	for name, plaintext := range inputs {
+		encrypted := encryptTestData(t, plaintext, EncryptConfig{Password: password})
+		for _, workers := range []int{2, 3, 8} {
+			t.Run(fmt.Sprintf("%s/workers=%d", name, workers), func(t *testing.T) {
+				var decrypted bytes.Buffer
+				digest, err := DecryptStreamWithDigest(bytes.NewReader(encrypted), &decrypted, DecryptConfig{Password: password, Workers: workers}, "")
+				if err != nil {
+					t.Fatalf("DecryptStreamWithDigest() error = %v", err)
+				}
+				if !bytes.Equal(decrypted.Bytes(), plaintext) {
+					t.Errorf("decrypted %d bytes, want %d", decrypted.Len(), len(plaintext))
+				}
+				if !digest.Verified {
+					t.Error("file_md5 was not verified")
+				}
+			})
+		}
+	}
+}
+
+func TestDecryptStreamPipelinedErrors(t *testing.T) {
+	password := []byte("testpassword")
+	plaintext := make([]byte, 1<<20)
+	rand.Read(plaintext)
+	encrypted := encryptTestData(t, plaintext, EncryptConfig{Password: password})
+	config := DecryptConfig{Password: password, Workers: 4}
+
+	// 输出写入失败
+	err := DecryptStream(bytes.NewReader(encrypted), &failingWriter{limit: 100000}, config)
+	if !errors.Is(err, errTestWrite) {
+		t.Errorf("DecryptStream() error = %v, want write error", err)
+	}
+
+	// 解密过程中取消
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	writer := &cancelWriter{cancel: cancel}
+	err = DecryptStreamContext(ctx, bytes.NewReader(encrypted), writer, config)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("DecryptStreamContext() error = %v, want context.Canceled", err)
+	}
+}
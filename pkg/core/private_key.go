@@ -0,0 +1,271 @@
+package core
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// ErrPassphraseRequired 表示私钥已加密但没有提供口令
+var ErrPassphraseRequired = errors.New("private key is encrypted and requires a passphrase")
+
+// ErrIncorrectPassphrase 表示私钥口令错误
+var ErrIncorrectPassphrase = errors.New("incorrect private key passphrase")
+
+// maxPBKDF2Iterations 限制加密私钥的 PBKDF2 迭代次数，防止构造的密钥文件让派生运行过久。
+// OpenSSL 默认 2048 次，常见建议值也远低于此上限
+const maxPBKDF2Iterations = 10000000
+
+var (
+	oidPBES2      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACSHA224 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 8}
+	oidHMACSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+// PKCS#8 加密私钥结构 (RFC 5208)
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// PBES2 参数 (RFC 8018)
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// PBKDF2 参数 (RFC 8018)
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// IsEncryptedPrivateKey 检查私钥是否为需要口令的加密 PEM
+func IsEncryptedPrivateKey(privateKey []byte) bool {
+	block := findPrivateKeyBlock(privateKey)
+	if block == nil {
+		return false
+	}
+	return block.Type == "ENCRYPTED PRIVATE KEY" || x509.IsEncryptedPEMBlock(block)
+}
+
+// parsePrivateKey 解析 DER、PEM 以及加密 PEM 格式的 RSA 私钥
+func parsePrivateKey(privateKey, passphrase []byte) (*rsa.PrivateKey, error) {
+	block := findPrivateKeyBlock(privateKey)
+	if block == nil {
+		if bytes.Contains(privateKey, []byte("-----BEGIN")) {
+			return nil, errors.New("PEM data contains no private key block")
+		}
+		return parseDERPrivateKey(privateKey, "DER")
+	}
+
+	switch {
+	case block.Type == "ENCRYPTED PRIVATE KEY":
+		if len(passphrase) == 0 {
+			return nil, fmt.Errorf("encrypted PKCS#8 private key: %w", ErrPassphraseRequired)
+		}
+		der, err := decryptPKCS8(block.Bytes, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("encrypted PKCS#8 private key: %w", err)
+		}
+		key, err := parsePKCS8RSA(der)
+		if err != nil {
+			// 解密后无法解析，几乎总是口令错误
+			return nil, fmt.Errorf("encrypted PKCS#8 private key: %w", ErrIncorrectPassphrase)
+		}
+		return key, nil
+
+	// 旧式加密 PEM (Proc-Type: 4,ENCRYPTED)，标准库已标记弃用但仍需支持
+	case x509.IsEncryptedPEMBlock(block):
+		format := fmt.Sprintf("legacy encrypted PEM %q", block.Type)
+		if len(passphrase) == 0 {
+			return nil, fmt.Errorf("%s: %w", format, ErrPassphraseRequired)
+		}
+		der, err := x509.DecryptPEMBlock(block, passphrase)
+		if err != nil {
+			if errors.Is(err, x509.IncorrectPasswordError) {
+				return nil, fmt.Errorf("%s: %w", format, ErrIncorrectPassphrase)
+			}
+			return nil, fmt.Errorf("%s: %v", format, err)
+		}
+		key, err := parseDERPrivateKey(der, format)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", format, ErrIncorrectPassphrase)
+		}
+		return key, nil
+
+	case block.Type == "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse PKCS#1 PEM private key: %v", err)
+		}
+		return key, nil
+
+	case block.Type == "PRIVATE KEY":
+		key, err := parsePKCS8RSA(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse PKCS#8 PEM private key: %v", err)
+		}
+		return key, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported PEM private key type %q", block.Type)
+	}
+}
+
+// findPrivateKeyBlock 返回第一个私钥 PEM 块，跳过参数、证书等其他块
+func findPrivateKeyBlock(data []byte) *pem.Block {
+	for {
+		block, rest := pem.Decode(data)
+		if block == nil {
+			return nil
+		}
+		if strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			return block
+		}
+		data = rest
+	}
+}
+
+// parseDERPrivateKey 依次尝试 PKCS#1 和 PKCS#8
+func parseDERPrivateKey(der []byte, format string) (*rsa.PrivateKey, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	key, err := parsePKCS8RSA(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s private key as PKCS#1 or PKCS#8: %v", format, err)
+	}
+	return key, nil
+}
+
+func parsePKCS8RSA(der []byte) (*rsa.PrivateKey, error) {
+	keyInterface, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := keyInterface.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("not an RSA private key: %T", keyInterface)
+	}
+	return key, nil
+}
+
+// decryptPKCS8 解密 PBES2 (PBKDF2 + AES/3DES-CBC) 加密的 PKCS#8 私钥
+func decryptPKCS8(der, passphrase []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("malformed encrypted private key: %v", err)
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported encryption algorithm %v (only PBES2 is supported)", info.Algorithm.Algorithm)
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("malformed PBES2 parameters: %v", err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation function %v", params.KeyDerivationFunc.Algorithm)
+	}
+
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, fmt.Errorf("malformed PBKDF2 parameters: %v", err)
+	}
+	if kdf.IterationCount < 1 || kdf.IterationCount > maxPBKDF2Iterations {
+		return nil, fmt.Errorf("unsupported PBKDF2 iteration count %d", kdf.IterationCount)
+	}
+
+	prf, err := pbkdf2PRF(kdf.PRF.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("malformed cipher parameters: %v", err)
+	}
+
+	var keyLen int
+	var newCipher func([]byte) (cipher.Block, error)
+	scheme := params.EncryptionScheme.Algorithm
+	switch {
+	case scheme.Equal(oidAES128CBC):
+		keyLen, newCipher = 16, aes.NewCipher
+	case scheme.Equal(oidAES192CBC):
+		keyLen, newCipher = 24, aes.NewCipher
+	case scheme.Equal(oidAES256CBC):
+		keyLen, newCipher = 32, aes.NewCipher
+	case scheme.Equal(oidDESEDE3CBC):
+		keyLen, newCipher = 24, des.NewTripleDESCipher
+	default:
+		return nil, fmt.Errorf("unsupported cipher %v", scheme)
+	}
+
+	key := pbkdf2.Key(passphrase, kdf.Salt, kdf.IterationCount, keyLen, prf)
+	block, err := newCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() || len(info.EncryptedData) == 0 || len(info.EncryptedData)%block.BlockSize() != 0 {
+		return nil, errors.New("malformed encrypted private key data")
+	}
+
+	plaintext := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, info.EncryptedData)
+
+	// 填充不正确说明口令错误
+	pad := int(plaintext[len(plaintext)-1])
+	if pad == 0 || pad > block.BlockSize() {
+		return nil, ErrIncorrectPassphrase
+	}
+	for _, b := range plaintext[len(plaintext)-pad:] {
+		if int(b) != pad {
+			return nil, ErrIncorrectPassphrase
+		}
+	}
+	return plaintext[:len(plaintext)-pad], nil
+}
+
+func pbkdf2PRF(oid asn1.ObjectIdentifier) (func() hash.Hash, error) {
+	switch {
+	case len(oid) == 0 || oid.Equal(oidHMACSHA1):
+		return sha1.New, nil
+	case oid.Equal(oidHMACSHA224):
+		return sha256.New224, nil
+	case oid.Equal(oidHMACSHA256):
+		return sha256.New, nil
+	case oid.Equal(oidHMACSHA384):
+		return sha512.New384, nil
+	case oid.Equal(oidHMACSHA512):
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("unsupported PBKDF2 PRF %v", oid)
+	}
+}
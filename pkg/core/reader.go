@@ -0,0 +1,74 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// errReaderClosed 表示在 Close 之后继续读取
+var errReaderClosed = errors.New("decrypting reader is closed")
+
+// decryptingReader 按需从底层流解码、解密和解压，实现 io.ReadCloser
+type decryptingReader struct {
+	decoder   *StreamDecoder
+	decrypter *streamDecrypter
+	// 已解压但尚未被读走的数据
+	buf    bytes.Buffer
+	digest DigestResult
+	err    error
+}
+
+// NewDecryptingReader 返回一个解密读取器，调用方读取时才解码、解密和解压数据。
+// 魔数头在创建时验证；凭据、完整性等错误（包括 file_md5 校验失败）由 Read 返回。
+// Close 不会关闭底层的 r
+func NewDecryptingReader(r io.Reader, config DecryptConfig) (io.ReadCloser, error) {
+	decoder := NewStreamDecoder(r)
+	if err := decoder.ValidateHeader(); err != nil {
+		return nil, fmt.Errorf("failed to decode stream: %w", err)
+	}
+
+	dr := &decryptingReader{decoder: decoder}
+	decrypter, err := newStreamDecrypter(&dr.buf, config, "", &dr.digest)
+	if err != nil {
+		return nil, err
+	}
+	dr.decrypter = decrypter
+	return dr, nil
+}
+
+func (dr *decryptingReader) Read(p []byte) (int, error) {
+	for dr.buf.Len() == 0 && dr.err == nil {
+		dr.err = dr.step()
+	}
+	if dr.buf.Len() > 0 {
+		return dr.buf.Read(p)
+	}
+	return 0, dr.err
+}
+
+// step 处理下一个条目，流正常结束时返回 io.EOF
+func (dr *decryptingReader) step() error {
+	item, err := dr.decoder.Next()
+	if err == io.EOF {
+		if err := dr.decrypter.finish(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	if err != nil {
+		return err
+	}
+	return dr.decrypter.process(item)
+}
+
+func (dr *decryptingReader) Close() error {
+	if dr.err == errReaderClosed {
+		return nil
+	}
+	dr.decrypter.close()
+	dr.buf.Reset()
+	dr.err = errReaderClosed
+	return nil
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDecryptingReader(t *testing.T) {
+	password := []byte("testpassword")
+	plaintext := bytes.Repeat([]byte("pull based decryption "), 20000)
+	encrypted := encryptTestData(t, plaintext, EncryptConfig{Password: password})
+
+	tests := []struct {
+		name  string
+		input func() io.Reader
+		read  func(io.Reader) io.Reader
+	}{
+		{"whole", func() io.Reader { return bytes.NewReader(encrypted) }, func(r io.Reader) io.Reader { return r }},
+		{"short input reads", func() io.Reader { return iotest.HalfReader(bytes.NewReader(encrypted)) }, func(r io.Reader) io.Reader { return r }},
+		{"one byte reads", func() io.Reader { return bytes.NewReader(encrypted) }, iotest.OneByteReader},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := NewDecryptingReader(tt.input(), DecryptConfig{Password: password})
+			if err != nil {
+				t.Fatalf("NewDecryptingReader() error = %v", err)
+			}
+			defer reader.Close()
+
+			decrypted, err := io.ReadAll(tt.read(reader))
+			if err != nil {
+				t.Fatalf("ReadAll() error = %v", err)
+			}
+			if !bytes.Equal(decrypted, plaintext) {
+				t.Errorf("decrypted %d bytes, want %d", len(decrypted), len(plaintext))
+			}
+		})
+	}
+}
+
+func TestDecryptingReaderErrors(t *testing.T) {
+	password := []byte("testpassword")
+	encrypted := encryptTestData(t, []byte("reader errors"), EncryptConfig{Password: password})
+
+	if _, err := NewDecryptingReader(bytes.NewReader([]byte("not encrypted")), DecryptConfig{Password: password}); !errors.Is(err, ErrCorruptHeader) {
+		t.Errorf("NewDecryptingReader() error = %v, want ErrCorruptHeader", err)
+	}
+
+	// 凭据错误由 Read 返回
+	reader, err := NewDecryptingReader(bytes.NewReader(encrypted), DecryptConfig{Password: []byte("wrong")})
+	if err != nil {
+		t.Fatalf("NewDecryptingReader() error = %v", err)
+	}
+	if _, err := io.ReadAll(reader); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("ReadAll() error = %v, want ErrWrongPassword", err)
+	}
+
+	// file_md5 校验失败由最后一次 Read 返回
+	tampered := append([]byte{}, encrypted...)
+	i := bytes.LastIndex(tampered, []byte("file_md5")) + len("file_md5") + 3
+	tampered[i] ^= 0x01
+	reader, err = NewDecryptingReader(bytes.NewReader(tampered), DecryptConfig{Password: password})
+	if err != nil {
+		t.Fatalf("NewDecryptingReader() error = %v", err)
+	}
+	if _, err := io.ReadAll(reader); !errors.Is(err, ErrIntegrity) {
+		t.Errorf("ReadAll() error = %v, want ErrIntegrity", err)
+	}
+
+	// 关闭后不能再读取
+	reader, err = NewDecryptingReader(bytes.NewReader(encrypted), DecryptConfig{Password: password})
+	if err != nil {
+		t.Fatalf("NewDecryptingReader() error = %v", err)
+	}
+	if err := reader.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := reader.Read(make([]byte, 16)); err == nil {
+		t.Error("Read() after Close should fail")
+	}
+}
@@ -1,10 +1,10 @@
 package core
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/binary"
 	"encoding/hex"
-	"errors"
 	"fmt"
 	"io"
 )
@@ -16,6 +16,8 @@ const (
 // 流式解码器
 type StreamDecoder struct {
 	reader io.Reader
+	// 当前字典展开后尚未被 Next 返回的条目
+	pending []StreamItem
 }
 
 func NewStreamDecoder(reader io.Reader) *StreamDecoder {
@@ -25,48 +27,58 @@ func NewStreamDecoder(reader io.Reader) *StreamDecoder {
 // 验证魔数和哈希
 func (sd *StreamDecoder) ValidateHeader() error {
 	magic := make([]byte, len(MagicHeader))
-	n, err := sd.reader.Read(magic)
-	if err != nil {
+	if err := sd.readHeaderField(magic, "magic header"); err != nil {
 		return err
 	}
-	if n != len(MagicHeader) {
-		return errors.New("incomplete magic header")
-	}
 
 	if string(magic) != MagicHeader {
-		return fmt.Errorf("invalid magic header: expected %s, got %s", MagicHeader, string(magic))
+		return fmt.Errorf("%w: invalid magic header: expected %s, got %s", ErrCorruptHeader, MagicHeader, string(magic))
 	}
 
 	// 读取并验证魔数哈希
 	hashBytes := make([]byte, 32)
-	n, err = sd.reader.Read(hashBytes)
-	if err != nil {
+	if err := sd.readHeaderField(hashBytes, "magic hash"); err != nil {
 		return err
 	}
-	if n != 32 {
-		return errors.New("incomplete magic hash")
-	}
 
 	expectedHash := md5.Sum([]byte(MagicHeader))
 	expectedHashStr := hex.EncodeToString(expectedHash[:])
 
 	if string(hashBytes) != expectedHashStr {
-		return fmt.Errorf("invalid magic hash: expected %s, got %s", expectedHashStr, string(hashBytes))
+		return fmt.Errorf("%w: invalid magic hash: expected %s, got %s", ErrCorruptHeader, expectedHashStr, string(hashBytes))
 	}
 
 	return nil
 }
 
-// 从流中读取对象
+// readHeaderField 读取魔数头字段，长度不足说明不是有效的加密文件
+func (sd *StreamDecoder) readHeaderField(buf []byte, name string) error {
+	if _, err := io.ReadFull(sd.reader, buf); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return fmt.Errorf("%w: incomplete %s", ErrCorruptHeader, name)
+		}
+		return err
+	}
+	return nil
+}
+
+// readFull 读满 buf，对象中途结束说明文件被截断
+func (sd *StreamDecoder) readFull(buf []byte, name string) error {
+	if _, err := io.ReadFull(sd.reader, buf); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return fmt.Errorf("%w: incomplete %s", ErrTruncated, name)
+		}
+		return err
+	}
+	return nil
+}
+
+// 从流中读取对象，流在对象边界结束时返回 io.EOF
 func (sd *StreamDecoder) ReadObject() (interface{}, error) {
 	headerByte := make([]byte, 1)
-	n, err := sd.reader.Read(headerByte)
-	if err != nil {
+	if _, err := io.ReadFull(sd.reader, headerByte); err != nil {
 		return nil, err
 	}
-	if n != 1 {
-		return nil, io.EOF
-	}
 
 	switch headerByte[0] {
 	case 0x42: // OrderedDict
@@ -80,14 +92,14 @@ func (sd *StreamDecoder) ReadObject() (interface{}, error) {
 	case 0x01: // Integer
 		return sd.readInt()
 	default:
-		return nil, fmt.Errorf("unknown type byte: 0x%02X", headerByte[0])
+		return nil, fmt.Errorf("%w: unknown type byte: 0x%02X", ErrCorruptStream, headerByte[0])
 	}
 }
 
-func (sd *StreamDecoder) readOrderedDict() (map[string]interface{}, error) {
-	result := make(map[string]interface{})
+func (sd *StreamDecoder) readOrderedDict() (*OrderedDict, error) {
+	result := NewOrderedDict()
 	for {
-		key, err := sd.ReadObject()
+		key, err := sd.readDictObject()
 		if err != nil {
 			return nil, err
 		}
@@ -97,39 +109,39 @@ func (sd *StreamDecoder) readOrderedDict() (map[string]interface{}, error) {
 
 		keyStr, ok := key.(string)
 		if !ok {
-			return nil, errors.New("ordered dict key must be string")
+			return nil, fmt.Errorf("%w: ordered dict key must be string", ErrCorruptStream)
 		}
 
-		value, err := sd.ReadObject()
+		value, err := sd.readDictObject()
 		if err != nil {
 			return nil, err
 		}
 
-		result[keyStr] = value
+		result.Set(keyStr, value)
 	}
 	return result, nil
 }
 
+// readDictObject 读取字典内的对象，字典未结束时遇到 EOF 视为截断
+func (sd *StreamDecoder) readDictObject() (interface{}, error) {
+	obj, err := sd.ReadObject()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: incomplete ordered dict", ErrTruncated)
+	}
+	return obj, err
+}
+
 func (sd *StreamDecoder) readBytes() ([]byte, error) {
 	lengthBytes := make([]byte, 2)
-	n, err := sd.reader.Read(lengthBytes)
-	if err != nil {
+	if err := sd.readFull(lengthBytes, "length field"); err != nil {
 		return nil, err
 	}
-	if n != 2 {
-		return nil, errors.New("incomplete length field")
-	}
 
 	length := binary.BigEndian.Uint16(lengthBytes)
 	data := make([]byte, length)
-
-	n, err = sd.reader.Read(data)
-	if err != nil {
+	if err := sd.readFull(data, "data"); err != nil {
 		return nil, err
 	}
-	if n != int(length) {
-		return nil, errors.New("incomplete data")
-	}
 
 	return data, nil
 }
@@ -144,17 +156,13 @@ func (sd *StreamDecoder) readString() (string, error) {
 
 func (sd *StreamDecoder) readInt() (int, error) {
 	lengthByte := make([]byte, 1)
-	n, err := sd.reader.Read(lengthByte)
-	if err != nil {
+	if err := sd.readFull(lengthByte, "length byte"); err != nil {
 		return 0, err
 	}
-	if n != 1 {
-		return 0, errors.New("incomplete length byte")
-	}
 
 	length := int(lengthByte[0])
 	if length > 8 {
-		return 0, errors.New("integer too large")
+		return 0, fmt.Errorf("%w: integer too large", ErrCorruptStream)
 	}
 
 	if length == 0 {
@@ -162,13 +170,9 @@ func (sd *StreamDecoder) readInt() (int, error) {
 	}
 
 	data := make([]byte, length)
-	n, err = sd.reader.Read(data)
-	if err != nil {
+	if err := sd.readFull(data, "integer data"); err != nil {
 		return 0, err
 	}
-	if n != length {
-		return 0, errors.New("incomplete integer data")
-	}
 
 	// 大端序转换
 	result := 0
@@ -179,53 +183,102 @@ func (sd *StreamDecoder) readInt() (int, error) {
 	return result, nil
 }
 
+// Next 返回流中的下一个条目：元数据字典按线上顺序逐个字段返回，数据字典返回一个数据块。
+// 调用前需要先调用 ValidateHeader；流正常结束时返回 io.EOF。
+// Next 在调用方的协程中同步读取，不启动额外的协程
+func (sd *StreamDecoder) Next() (StreamItem, error) {
+	for len(sd.pending) == 0 {
+		items, err := sd.readItems()
+		if err != nil {
+			return StreamItem{}, err
+		}
+		sd.pending = items
+	}
+
+	item := sd.pending[0]
+	sd.pending = sd.pending[1:]
+	return item, nil
+}
+
+// readItems 读取下一个对象并展开成流条目。流在对象边界结束时返回 io.EOF
+func (sd *StreamDecoder) readItems() ([]StreamItem, error) {
+	obj, err := sd.ReadObject()
+	if err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		return nil, nil
+	}
+
+	dict, ok := obj.(*OrderedDict)
+	if !ok {
+		return nil, fmt.Errorf("%w: expected dictionary object", ErrCorruptStream)
+	}
+
+	typeValue, _ := dict.Get("type")
+	itemType, ok := typeValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing type field", ErrCorruptStream)
+	}
+
+	var items []StreamItem
+	switch itemType {
+	case "metadata":
+		for _, k := range dict.Keys() {
+			if k != "type" {
+				v, _ := dict.Get(k)
+				items = append(items, StreamItem{Key: k, Value: v})
+			}
+		}
+	case "data":
+		value, _ := dict.Get("data")
+		if data, ok := value.([]byte); ok {
+			items = append(items, StreamItem{Data: data})
+		}
+	}
+	return items, nil
+}
+
 // 解码 CloudSync 加密流
+//
+// Deprecated: 调用方提前返回时解码协程会一直阻塞，请使用 NewStreamDecoder 和 StreamDecoder.Next
 func DecodeCSEncStream(reader io.Reader) (<-chan StreamItem, error) {
+	return DecodeCSEncStreamContext(context.Background(), reader)
+}
+
+// DecodeCSEncStreamContext 解码 CloudSync 加密流，ctx 取消后解码协程停止发送并退出
+//
+// Deprecated: 请使用 NewStreamDecoder 和 StreamDecoder.Next
+func DecodeCSEncStreamContext(ctx context.Context, reader io.Reader) (<-chan StreamItem, error) {
 	decoder := NewStreamDecoder(reader)
 	if err := decoder.ValidateHeader(); err != nil {
 		return nil, err
 	}
 
 	ch := make(chan StreamItem)
+	send := func(item StreamItem) bool {
+		select {
+		case ch <- item:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
 	go func() {
 		defer close(ch)
 
-		for {
-			obj, err := decoder.ReadObject()
+		for ctx.Err() == nil {
+			item, err := decoder.Next()
 			if err != nil {
 				if err != io.EOF {
-					ch <- StreamItem{Error: err}
+					send(StreamItem{Error: err})
 				}
 				return
 			}
-			if obj == nil {
-				continue
-			}
-
-			dict, ok := obj.(map[string]interface{})
-			if !ok {
-				ch <- StreamItem{Error: errors.New("expected dictionary object")}
-				return
-			}
-
-			itemType, ok := dict["type"].(string)
-			if !ok {
-				ch <- StreamItem{Error: errors.New("missing type field")}
+			if !send(item) {
 				return
 			}
-
-			switch itemType {
-			case "metadata":
-				for k, v := range dict {
-					if k != "type" {
-						ch <- StreamItem{Key: k, Value: v}
-					}
-				}
-			case "data":
-				if data, ok := dict["data"].([]byte); ok {
-					ch <- StreamItem{Data: data}
-				}
-			}
 		}
 	}()
 
@@ -237,4 +290,92 @@ type StreamItem struct {
 	Value interface{}
 	Data  []byte
 	Error error
-}
\ No newline at end of file
+}
+
+// 流式编码器，StreamDecoder 的逆操作
+type StreamEncoder struct {
+	writer io.Writer
+}
+
+func NewStreamEncoder(writer io.Writer) *StreamEncoder {
+	return &StreamEncoder{writer: writer}
+}
+
+// 写入魔数和魔数哈希
+func (se *StreamEncoder) WriteHeader() error {
+	hash := md5.Sum([]byte(MagicHeader))
+	header := MagicHeader + hex.EncodeToString(hash[:])
+	_, err := io.WriteString(se.writer, header)
+	return err
+}
+
+// 向流中写入对象，支持 *OrderedDict、nil、[]byte、string 和整数
+func (se *StreamEncoder) WriteObject(obj interface{}) error {
+	switch v := obj.(type) {
+	case *OrderedDict:
+		return se.writeOrderedDict(v)
+	case nil:
+		_, err := se.writer.Write([]byte{0x40})
+		return err
+	case []byte:
+		return se.writeBytes(0x11, v)
+	case string:
+		return se.writeBytes(0x10, []byte(v))
+	case int:
+		return se.writeInt(int64(v))
+	case int64:
+		return se.writeInt(v)
+	default:
+		return fmt.Errorf("unsupported object type: %T", obj)
+	}
+}
+
+func (se *StreamEncoder) writeOrderedDict(dict *OrderedDict) error {
+	if _, err := se.writer.Write([]byte{0x42}); err != nil {
+		return err
+	}
+	for _, key := range dict.Keys() {
+		value, _ := dict.Get(key)
+		if err := se.WriteObject(key); err != nil {
+			return err
+		}
+		if err := se.WriteObject(value); err != nil {
+			return err
+		}
+	}
+	// 以 None 结束字典
+	return se.WriteObject(nil)
+}
+
+func (se *StreamEncoder) writeBytes(typeByte byte, data []byte) error {
+	if len(data) > 0xFFFF {
+		return fmt.Errorf("data too long: %d bytes", len(data))
+	}
+
+	header := make([]byte, 3)
+	header[0] = typeByte
+	binary.BigEndian.PutUint16(header[1:], uint16(len(data)))
+	if _, err := se.writer.Write(header); err != nil {
+		return err
+	}
+	_, err := se.writer.Write(data)
+	return err
+}
+
+func (se *StreamEncoder) writeInt(value int64) error {
+	if value < 0 {
+		return fmt.Errorf("negative integer not supported: %d", value)
+	}
+
+	// 大端序，去掉前导零字节
+	var data []byte
+	for v := value; v > 0; v >>= 8 {
+		data = append([]byte{byte(v)}, data...)
+	}
+
+	if _, err := se.writer.Write([]byte{0x01, byte(len(data))}); err != nil {
+		return err
+	}
+	_, err := se.writer.Write(data)
+	return err
+}
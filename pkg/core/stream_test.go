@@ -0,0 +1,106 @@
+package core
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"runtime"
+	"testing"
+)
+
+// 测试辅助函数：按 CSEnc 格式编码字符串
+func encodeTestString(buf *bytes.Buffer, s string) {
+	buf.WriteByte(0x10)
+	binary.Write(buf, binary.BigEndian, uint16(len(s)))
+	buf.WriteString(s)
+}
+
+func TestStreamDecoderNextKeepsMetadataOrder(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString(MagicHeader)
+	magicHash := md5.Sum([]byte(MagicHeader))
+	buf.WriteString(hex.EncodeToString(magicHash[:]))
+
+	keys := []string{"type", "version", "salt", "enc_key1", "key1_hash", "session_key_hash", "digest"}
+	buf.WriteByte(0x42)
+	for _, key := range keys {
+		encodeTestString(&buf, key)
+		if key == "type" {
+			encodeTestString(&buf, "metadata")
+		} else {
+			encodeTestString(&buf, "value-"+key)
+		}
+	}
+	buf.WriteByte(0x40)
+
+	// 多次解码，确保顺序不受 map 遍历影响
+	for i := 0; i < 20; i++ {
+		decoder := NewStreamDecoder(bytes.NewReader(buf.Bytes()))
+		if err := decoder.ValidateHeader(); err != nil {
+			t.Fatalf("ValidateHeader() error = %v", err)
+		}
+
+		var got []string
+		for {
+			item, err := decoder.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Next() error = %v", err)
+			}
+			got = append(got, item.Key)
+		}
+
+		want := keys[1:]
+		if len(got) != len(want) {
+			t.Fatalf("got %d keys, want %d", len(got), len(want))
+		}
+		for j := range want {
+			if got[j] != want[j] {
+				t.Fatalf("key %d = %q, want %q", j, got[j], want[j])
+			}
+		}
+	}
+}
+
+func TestDecryptStreamDoesNotLeakGoroutines(t *testing.T) {
+	encrypted := encryptTestData(t, bytes.Repeat([]byte("leak"), 100000), EncryptConfig{Password: []byte("right")})
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 50; i++ {
+		// 凭据错误在第一个数据块处提前返回
+		if err := DecryptStream(bytes.NewReader(encrypted), io.Discard, DecryptConfig{Password: []byte("wrong")}); err == nil {
+			t.Fatal("DecryptStream() with wrong password should fail")
+		}
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("goroutines grew from %d to %d", before, after)
+	}
+}
+
+func TestInspectStream(t *testing.T) {
+	var encrypted bytes.Buffer
+	plaintext := bytes.Repeat([]byte{0x5A}, 100000)
+	if err := EncryptStream(bytes.NewReader(plaintext), &encrypted, EncryptConfig{Password: []byte("pw")}); err != nil {
+		t.Fatalf("EncryptStream() error = %v", err)
+	}
+
+	info, err := InspectStream(bytes.NewReader(encrypted.Bytes()))
+	if err != nil {
+		t.Fatalf("InspectStream() error = %v", err)
+	}
+
+	if info.VersionMajor != 3 || !info.HasEncKey1 || info.HasEncKey2 {
+		t.Errorf("unexpected header info: %+v", info)
+	}
+	expectedMD5 := md5.Sum(plaintext)
+	if info.FileMD5 != hex.EncodeToString(expectedMD5[:]) {
+		t.Errorf("FileMD5 = %s, want %x", info.FileMD5, expectedMD5)
+	}
+	if info.ChunkCount == 0 || info.CiphertextSize%16 != 0 {
+		t.Errorf("unexpected chunk stats: %d chunks, %d bytes", info.ChunkCount, info.CiphertextSize)
+	}
+}
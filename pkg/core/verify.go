@@ -0,0 +1,60 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// CheckPassword 只读取文件头部的元数据，验证密码是否正确，不解密任何数据块
+func CheckPassword(reader io.Reader, password []byte) error {
+	return CheckCredentials(reader, DecryptConfig{Password: password})
+}
+
+// CheckCredentials 只读取文件头部的元数据，用 key1_hash 验证密码，
+// 并用 session_key_hash 验证解出的会话密钥
+func CheckCredentials(reader io.Reader, config DecryptConfig) error {
+	meta, err := readHeaderMetadata(reader)
+	if err != nil {
+		return err
+	}
+
+	if config.Password != nil && meta.encKey1 == nil {
+		return fmt.Errorf("%w: file has no password-encrypted session key (enc_key1)", ErrWrongPassword)
+	}
+	if config.Password == nil && config.PrivateKey != nil && meta.encKey2 == nil {
+		return fmt.Errorf("%w: file has no key-encrypted session key (enc_key2)", ErrWrongKey)
+	}
+	if meta.sessionKeyHash == "" && (config.Password == nil || meta.key1Hash == "") {
+		return errors.New("file has no hash to verify credentials against")
+	}
+
+	_, err = meta.sessionKey(config)
+	return err
+}
+
+// readHeaderMetadata 读取第一个数据块之前的所有元数据
+func readHeaderMetadata(reader io.Reader) (*streamMetadata, error) {
+	decoder := NewStreamDecoder(reader)
+	if err := decoder.ValidateHeader(); err != nil {
+		return nil, err
+	}
+
+	meta := &streamMetadata{}
+	for {
+		item, err := decoder.Next()
+		if err == io.EOF {
+			return meta, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if item.Key == "" {
+			// 元数据已经读完，不再读取数据块
+			return meta, nil
+		}
+		if err := meta.apply(item.Key, item.Value); err != nil {
+			return nil, err
+		}
+	}
+}
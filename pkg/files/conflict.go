@@ -0,0 +1,114 @@
+package files
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ConflictPolicy 输出文件已存在时的处理方式
+type ConflictPolicy string
+
+const (
+	// ConflictFail 报错，不修改已有文件（默认）
+	ConflictFail ConflictPolicy = "fail"
+	// ConflictSkip 跳过该文件，保留已有文件
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictOverwrite 覆盖已有文件
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictRename 写入 "name (1).ext" 这样的新文件名
+	ConflictRename ConflictPolicy = "rename"
+	// ConflictSkipIfSame 已有文件与加密文件记录的 file_md5 一致时跳过，否则覆盖
+	ConflictSkipIfSame ConflictPolicy = "skip-if-same"
+)
+
+// ErrOutputExists 表示输出文件已存在且策略为 fail
+var ErrOutputExists = errors.New("output file already exists")
+
+// ParseConflictPolicy 解析命令行中的冲突策略，空字符串为 fail
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch policy := ConflictPolicy(s); policy {
+	case "":
+		return ConflictFail, nil
+	case ConflictFail, ConflictSkip, ConflictOverwrite, ConflictRename, ConflictSkipIfSame:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown conflict policy: %s (want skip, overwrite, rename, fail or skip-if-same)", s)
+}
+
+// outputPlan 按冲突策略决定的输出方式
+type outputPlan struct {
+	skip      bool
+	overwrite bool
+	rename    bool
+}
+
+// planOutput 检查输出文件是否存在并按策略决定如何写入
+func planOutput(inputFileName, outputFileName string, policy ConflictPolicy) (outputPlan, error) {
+	info, err := os.Stat(outputFileName)
+	if os.IsNotExist(err) {
+		return outputPlan{}, nil
+	}
+	if err != nil {
+		return outputPlan{}, fmt.Errorf("cannot access output file: %v", err)
+	}
+
+	switch policy {
+	case ConflictSkip:
+		return outputPlan{skip: true}, nil
+	case ConflictRename:
+		return outputPlan{rename: true}, nil
+	case ConflictOverwrite, ConflictSkipIfSame:
+		if !info.Mode().IsRegular() {
+			return outputPlan{}, fmt.Errorf("output path is not a regular file: %s", outputFileName)
+		}
+		if policy == ConflictSkipIfSame {
+			same, err := sameAsEncrypted(inputFileName, outputFileName)
+			if err != nil {
+				return outputPlan{}, err
+			}
+			if same {
+				return outputPlan{skip: true}, nil
+			}
+		}
+		return outputPlan{overwrite: true}, nil
+	}
+	return outputPlan{}, fmt.Errorf("%w: %s", ErrOutputExists, outputFileName)
+}
+
+// sameAsEncrypted 比较已有输出与加密文件末尾记录的 file_md5。
+// CSEnc 格式不记录明文大小，file_md5 一致即意味着大小和内容都一致；
+// 文件没有 file_md5 时无法判断，视为不同
+func sameAsEncrypted(inputFileName, outputFileName string) (bool, error) {
+	info, err := InspectFile(inputFileName)
+	if err != nil {
+		return false, err
+	}
+	if info.FileMD5 == "" {
+		return false, nil
+	}
+
+	output, err := os.Open(outputFileName)
+	if err != nil {
+		return false, fmt.Errorf("failed to open output file: %v", err)
+	}
+	defer output.Close()
+
+	hash := md5.New()
+	if _, err := io.Copy(hash, output); err != nil {
+		return false, fmt.Errorf("failed to read output file: %v", err)
+	}
+	return strings.EqualFold(hex.EncodeToString(hash.Sum(nil)), info.FileMD5), nil
+}
+
+// renamedOutput 返回第 n 个候选文件名，例如 "photo (1).jpg"
+func renamedOutput(outputFileName string, n int) string {
+	ext := filepath.Ext(outputFileName)
+	base := strings.TrimSuffix(outputFileName, ext)
+	return fmt.Sprintf("%s (%d)%s", base, n, ext)
+}
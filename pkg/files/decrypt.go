@@ -1,11 +1,16 @@
 package files
 
 import (
+	"archive/zip"
+	"context"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/synology-cloud-sync-decrypt-tool/syndecrypt-go/pkg/core"
@@ -14,49 +19,119 @@ import (
 
 // DecryptFile 解密单个文件
 func DecryptFile(inputFileName, outputFileName string, config core.DecryptConfig) error {
+	_, err := DecryptFileWithDigest(inputFileName, outputFileName, config)
+	return err
+}
+
+// DecryptFileContext 与 DecryptFile 相同，ctx 取消时删除未完成的输出并返回 ctx.Err()
+func DecryptFileContext(ctx context.Context, inputFileName, outputFileName string, config core.DecryptConfig) error {
+	_, err := DecryptFileWithDigestContext(ctx, inputFileName, outputFileName, config)
+	return err
+}
+
+// DecryptFileWithDigest 解密单个文件并返回 file_md5 校验结果
+func DecryptFileWithDigest(inputFileName, outputFileName string, config core.DecryptConfig) (core.DigestResult, error) {
+	return DecryptFileWithDigestContext(context.Background(), inputFileName, outputFileName, config)
+}
+
+// DecryptFileWithDigestContext 与 DecryptFileWithDigest 相同，ctx 取消时删除未完成的输出并返回 ctx.Err()
+func DecryptFileWithDigestContext(ctx context.Context, inputFileName, outputFileName string, config core.DecryptConfig) (core.DigestResult, error) {
+	output, err := DecryptFileWithOptions(ctx, inputFileName, outputFileName, config, DecryptOptions{})
+	return output.Digest, err
+}
+
+// FileOutput 单个文件的解密去向
+type FileOutput struct {
+	// Path 实际写入的输出路径，rename 策略下可能与请求的路径不同
+	Path string
+	// Skipped 为 true 时按冲突策略保留了已有文件，没有解密
+	Skipped bool
+	Digest  core.DigestResult
+}
+
+// DecryptFileWithOptions 解密单个文件，输出已存在时按 options.OnConflict 处理。
+// ctx 取消时删除未完成的输出并返回 ctx.Err()
+func DecryptFileWithOptions(ctx context.Context, inputFileName, outputFileName string, config core.DecryptConfig, options DecryptOptions) (FileOutput, error) {
+	output := FileOutput{Path: outputFileName}
+
+	if err := ctx.Err(); err != nil {
+		return output, err
+	}
+
 	// 检查输入文件是否存在
 	if !util.FileExists(inputFileName) {
-		return fmt.Errorf("input file does not exist: %s", inputFileName)
+		return output, fmt.Errorf("input file does not exist: %s", inputFileName)
 	}
 
 	// 检查输出文件是否已存在
-	if util.FileExists(outputFileName) {
-		return fmt.Errorf("output file already exists: %s", outputFileName)
+	plan, err := planOutput(inputFileName, outputFileName, options.OnConflict)
+	if err != nil {
+		return output, err
+	}
+	if plan.skip {
+		output.Skipped = true
+		return output, nil
 	}
 
 	// 确保输出目录存在
 	outputDir := filepath.Dir(outputFileName)
 	if err := util.EnsureDir(outputDir); err != nil {
-		return fmt.Errorf("failed to create output directory: %v", err)
+		return output, fmt.Errorf("failed to create output directory: %v", err)
 	}
 
 	// 打开输入文件
 	inputFile, err := os.Open(inputFileName)
 	if err != nil {
-		return fmt.Errorf("failed to open input file: %v", err)
+		return output, fmt.Errorf("failed to open input file: %v", err)
 	}
 	defer inputFile.Close()
 
-	// 创建输出文件
-	outputFile, err := os.Create(outputFileName)
+	// 在读取之前记录属性，读取会更新访问时间
+	inputInfo, err := inputFile.Stat()
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %v", err)
+		return output, fmt.Errorf("failed to stat input file: %v", err)
 	}
-	defer outputFile.Close()
+
+	// 取消时关闭输入文件，让阻塞中的读取立即返回
+	stop := context.AfterFunc(ctx, func() { inputFile.Close() })
+	defer stop()
+
+	// 先写入同目录下的隐藏临时文件，解密和摘要校验都成功后才改名为最终路径
+	outputFile, err := createOutput(outputFileName, plan)
+	if err != nil {
+		return output, err
+	}
+	defer outputFile.abort()
 
 	// 执行解密，传入文件名用于错误报告
-	if err := core.DecryptStreamWithFilename(inputFile, outputFile, config, inputFileName); err != nil {
-		// 如果解密失败，删除输出文件
-		outputFile.Close()
-		os.Remove(outputFileName)
-		return fmt.Errorf("decryption failed: %v", err)
+	output.Digest, err = core.DecryptStreamWithDigestContext(ctx, inputFile, outputFile, config, inputFileName)
+	if err != nil {
+		// 如果解密失败（包括摘要不一致和取消），删除临时文件，已有的输出保持不变
+		outputFile.abort()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return output, ctxErr
+		}
+		return output, fmt.Errorf("decryption failed: %w", err)
 	}
 
-	return nil
+	// 属性应用到临时文件上，改名后保持不变
+	if options.Preserve.any() {
+		if err := preserveAttributes(outputFile.Name(), inputInfo, options.Preserve); err != nil {
+			return output, err
+		}
+	}
+
+	output.Path, err = outputFile.commit()
+	return output, err
 }
 
 // DecryptFiles 解密多个文件
 func DecryptFiles(inputFiles []string, outputDir string, config core.DecryptConfig) error {
+	config, err := withCredentials(config)
+	if err != nil {
+		return err
+	}
+
 	for _, inputFile := range inputFiles {
 		// 生成输出文件名
 		baseName := filepath.Base(inputFile)
@@ -70,7 +145,7 @@ func DecryptFiles(inputFiles []string, outputDir string, config core.DecryptConf
 		fmt.Printf("Decrypting %s -> %s\n", inputFile, outputFile)
 
 		if err := DecryptFile(inputFile, outputFile, config); err != nil {
-			return fmt.Errorf("failed to decrypt %s: %v", inputFile, err)
+			return fmt.Errorf("failed to decrypt %s: %w", inputFile, err)
 		}
 	}
 
@@ -79,51 +154,85 @@ func DecryptFiles(inputFiles []string, outputDir string, config core.DecryptConf
 
 // DecryptDirectory 递归解密目录，返回详细的统计结果
 func DecryptDirectory(inputDir, outputDir string, config core.DecryptConfig) (*DecryptResults, error) {
-	results := NewDecryptResults()
-
-	err := filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	return DecryptDirectoryContext(context.Background(), inputDir, outputDir, config)
+}
 
-		// 跳过目录
-		if info.IsDir() {
-			return nil
-		}
+// DecryptDirectoryContext 与 DecryptDirectory 相同，ctx 取消时停止遍历，
+// 删除正在解密的文件的未完成输出，并返回已完成部分的结果和 ctx.Err()
+func DecryptDirectoryContext(ctx context.Context, inputDir, outputDir string, config core.DecryptConfig) (*DecryptResults, error) {
+	return DecryptDirectoryWithOptions(ctx, inputDir, outputDir, config, DecryptOptions{})
+}
 
-		// 计算相对路径
-		relPath, err := filepath.Rel(inputDir, path)
-		if err != nil {
-			return err
-		}
+// DecryptDirectoryWithOptions 递归解密目录中通过 options.Filter 的文件，按 options.Jobs 并发解密。
+// 结果按遍历顺序记录，与并发数无关。options.FailFast 时第一个文件失败后
+// 停止并返回已完成部分的结果和 ErrFailFast
+func DecryptDirectoryWithOptions(ctx context.Context, inputDir, outputDir string, config core.DecryptConfig, options DecryptOptions) (*DecryptResults, error) {
+	results := NewDecryptResults()
 
-		// 生成输出路径
-		outputPath := filepath.Join(outputDir, relPath)
+	config, err := withCredentials(config)
+	if err != nil {
+		return results, err
+	}
 
-		// 如果文件有加密扩展名，移除它
-		if ext := filepath.Ext(outputPath); ext == ".cse" || ext == ".enc" {
-			outputPath = outputPath[:len(outputPath)-len(ext)]
+	pool := newDecryptPool(ctx, options, config, results)
+	var dirs []preservedDir
+	// 需要时记录子目录的属性，输出目录本身保持不变
+	visitDir := func(path, relPath string, info os.FileInfo) error {
+		if options.Preserve.any() {
+			dirs = append(dirs, preservedDir{path: filepath.Join(outputDir, relPath), info: info})
+		}
+		return nil
+	}
+	err = walkDirectory(ctx, inputDir, options.Filter, visitDir, func(path, relPath string, info os.FileInfo) error {
+		if pool.failedFast() {
+			return ErrFailFast
 		}
 
-		// 执行解密并记录结果
-		result := decryptFileWithResult(path, outputPath, config)
-		results.AddResult(result)
+		// 交给工作池解密并记录结果，被取消的文件不计入结果
+		pool.submit(path, directoryOutputPath(outputDir, relPath))
 
 		return nil
 	})
+	pool.wait()
 
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err == nil && pool.failedFast() {
+		err = ErrFailFast
+	}
 	if err != nil {
 		return results, err
 	}
 
+	// 所有文件写完后再恢复目录属性
+	preserveDirectories(dirs, options.Preserve)
+
 	// 显示结果摘要（只在控制台打印，不保存到文件）
 	results.PrintSummary()
 
 	return results, nil
 }
 
-// decryptFileWithResult 解密单个文件并返回结果
-func decryptFileWithResult(inputFileName, outputFileName string, config core.DecryptConfig) DecryptResult {
+// directoryOutputPath 生成目录中文件的输出路径，文件有加密扩展名时移除它
+func directoryOutputPath(outputDir, relPath string) string {
+	outputPath := filepath.Join(outputDir, relPath)
+	if ext := filepath.Ext(outputPath); ext == ".cse" || ext == ".enc" {
+		outputPath = outputPath[:len(outputPath)-len(ext)]
+	}
+	return outputPath
+}
+
+// recordResult 记录结果，失败时立即输出错误信息
+func recordResult(results *DecryptResults, result DecryptResult) {
+	results.AddResult(result)
+	if !result.Success {
+		fmt.Printf("  ❌ %s - %s\n", result.InputFile, result.Error)
+	}
+}
+
+// DecryptFileWithResult 解密单个文件并返回结果，不输出任何信息
+func DecryptFileWithResult(ctx context.Context, inputFileName, outputFileName string, config core.DecryptConfig, options DecryptOptions) DecryptResult {
 	startTime := time.Now()
 	result := DecryptResult{
 		InputFile:  inputFileName,
@@ -133,56 +242,66 @@ func decryptFileWithResult(inputFileName, outputFileName string, config core.Dec
 
 	// 检查输入文件是否存在
 	if !util.FileExists(inputFileName) {
-		result.Error = fmt.Sprintf("input file does not exist: %s", inputFileName)
+		result.SetError(fmt.Errorf("input file does not exist: %s", inputFileName))
 		result.EndTime = time.Now()
 		result.Duration = result.EndTime.Sub(result.StartTime).String()
-		fmt.Printf("  ❌ %s - %s\n", inputFileName, result.Error)
 		return result
 	}
 
-	// 检查输出文件是否已存在
-	if util.FileExists(outputFileName) {
-		result.Error = fmt.Sprintf("output file already exists: %s", outputFileName)
-		result.EndTime = time.Now()
-		result.Duration = result.EndTime.Sub(result.StartTime).String()
-		fmt.Printf("  ❌ %s - %s\n", inputFileName, result.Error)
-		return result
-	}
+	// 执行解密（静默执行，只输出错误信息），输出已存在时按冲突策略处理
+	output, err := DecryptFileWithOptions(ctx, inputFileName, outputFileName, config, options)
+	result.EndTime = time.Now()
+	result.Duration = result.EndTime.Sub(result.StartTime).String()
+	result.OutputFile = output.Path
 
-	// 确保输出目录存在
-	outputDir := filepath.Dir(outputFileName)
-	if err := util.EnsureDir(outputDir); err != nil {
-		result.Error = fmt.Sprintf("failed to create output directory: %v", err)
-		result.EndTime = time.Now()
-		result.Duration = result.EndTime.Sub(result.StartTime).String()
-		fmt.Printf("  ❌ %s - %s\n", inputFileName, result.Error)
+	if err == nil && output.Skipped {
+		result.Success = true
+		result.Skipped = true
 		return result
 	}
 
-	// 执行解密（静默执行，只输出错误信息）
-	err := DecryptFile(inputFileName, outputFileName, config)
-	result.EndTime = time.Now()
-	result.Duration = result.EndTime.Sub(result.StartTime).String()
-
+	result.SetDigest(output.Digest, err)
 	if err != nil {
-		result.Error = err.Error()
-		fmt.Printf("  ❌ %s - %s\n", inputFileName, result.Error)
+		result.SetError(err)
 		return result
 	}
 
 	// 获取文件大小
-	if info, err := os.Stat(outputFileName); err == nil {
+	if info, err := os.Stat(output.Path); err == nil {
 		result.FileSize = info.Size()
 	}
 
 	result.Success = true
-	// 不再输出成功信息
 	return result
 }
 
-// LoadPasswordFromFile 从文件加载密码
+// LoadPasswordFromFile 从文件加载密码，去掉末尾的一个换行符（\n 或 \r\n）
 func LoadPasswordFromFile(passwordFile string) ([]byte, error) {
-	return util.ReadBinaryFile(passwordFile)
+	file, err := os.Open(passwordFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open password file: %v", err)
+	}
+	defer file.Close()
+	return ReadPassword(file)
+}
+
+// ReadPassword 读取全部输入作为密码，去掉末尾的一个换行符（\n 或 \r\n）。
+// 密码中的其他空白保持不变，空密码返回错误
+func ReadPassword(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read password: %v", err)
+	}
+	if n := len(data); n > 0 && data[n-1] == '\n' {
+		data = data[:n-1]
+		if n := len(data); n > 0 && data[n-1] == '\r' {
+			data = data[:n-1]
+		}
+	}
+	if len(data) == 0 {
+		return nil, errors.New("password is empty")
+	}
+	return data, nil
 }
 
 // LoadPrivateKeyFromFile 从文件加载私钥
@@ -195,6 +314,96 @@ func LoadPublicKeyFromFile(publicKeyFile string) ([]byte, error) {
 	return util.ReadBinaryFile(publicKeyFile)
 }
 
+// maxKeyZipEntrySize key.zip 中单个密钥文件的最大大小
+const maxKeyZipEntrySize = 1 << 20
+
+// LoadKeyPairFromZip 从 Cloud Sync 导出的 key.zip 中读取 private.pem 和 public.pem，
+// 密钥对在 core.NewCredentials 构建凭据时验证
+func LoadKeyPairFromZip(zipFile string) (privateKey, publicKey []byte, err error) {
+	archive, err := zip.OpenReader(zipFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open key zip: %v", err)
+	}
+	defer archive.Close()
+
+	// 优先按文件名查找，找不到时按 PEM 块类型识别
+	var candidates [][]byte
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+
+		data, err := readZipEntry(entry)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch strings.ToLower(path.Base(entry.Name)) {
+		case "private.pem":
+			privateKey = data
+		case "public.pem":
+			publicKey = data
+		default:
+			candidates = append(candidates, data)
+		}
+	}
+
+	for _, data := range candidates {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			continue
+		}
+		if privateKey == nil && strings.Contains(block.Type, "PRIVATE KEY") {
+			privateKey = data
+		} else if publicKey == nil && strings.Contains(block.Type, "PUBLIC KEY") {
+			publicKey = data
+		}
+	}
+
+	if privateKey == nil {
+		return nil, nil, fmt.Errorf("private.pem not found in %s", zipFile)
+	}
+	if publicKey == nil {
+		return nil, nil, fmt.Errorf("public.pem not found in %s", zipFile)
+	}
+
+	return privateKey, publicKey, nil
+}
+
+// LoadKeyZip 从 key.zip 加载密钥对并填入解密配置
+func LoadKeyZip(zipFile string, config *core.DecryptConfig) error {
+	privateKey, publicKey, err := LoadKeyPairFromZip(zipFile)
+	if err != nil {
+		return err
+	}
+
+	config.PrivateKey = privateKey
+	config.PublicKey = publicKey
+	return nil
+}
+
+// readZipEntry 读取 zip 中的单个文件，限制大小防止异常压缩包
+func readZipEntry(entry *zip.File) ([]byte, error) {
+	if entry.UncompressedSize64 > maxKeyZipEntrySize {
+		return nil, fmt.Errorf("key zip entry too large: %s", entry.Name)
+	}
+
+	reader, err := entry.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s in key zip: %v", entry.Name, err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, maxKeyZipEntrySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s in key zip: %v", entry.Name, err)
+	}
+	if len(data) > maxKeyZipEntrySize {
+		return nil, fmt.Errorf("key zip entry too large: %s", entry.Name)
+	}
+	return data, nil
+}
+
 // CopyFile 复制文件（用于测试）
 func CopyFile(src, dst string) error {
 	sourceFile, err := os.Open(src)
@@ -255,6 +464,19 @@ func ValidateConfig(config core.DecryptConfig) error {
 	return nil
 }
 
+// withCredentials 预先构建凭据缓存，批量解密的所有文件共享同一份解析结果
+func withCredentials(config core.DecryptConfig) (core.DecryptConfig, error) {
+	if config.Credentials != nil {
+		return config, nil
+	}
+	creds, err := core.NewCredentials(config)
+	if err != nil {
+		return config, fmt.Errorf("failed to load credentials: %w", err)
+	}
+	config.Credentials = creds
+	return config, nil
+}
+
 // ProgressCallback 进度回调函数
 type ProgressCallback func(current, total int64)
 
@@ -280,21 +502,20 @@ func DecryptFileWithProgress(inputFileName, outputFileName string, config core.D
 		callback: callback,
 	}
 
-	// 创建输出文件
-	outputFile, err := os.Create(outputFileName)
+	// 创建输出文件，成功后替换已有文件
+	outputFile, err := createOutput(outputFileName, outputPlan{overwrite: true})
 	if err != nil {
 		return err
 	}
-	defer outputFile.Close()
+	defer outputFile.abort()
 
 	// 执行解密
 	if err := core.DecryptStream(progressReader, outputFile, config); err != nil {
-		outputFile.Close()
-		os.Remove(outputFileName)
 		return err
 	}
 
-	return nil
+	_, err = outputFile.commit()
+	return err
 }
 
 // progressReader 跟踪读取进度
@@ -322,14 +543,26 @@ type BatchDecryptOptions struct {
 	FilePattern  string
 	Config       core.DecryptConfig
 	ProgressFunc ProgressCallback
+	// Jobs 同时解密的文件数，<= 0 时使用 CPU 核数
+	Jobs int
+	// OnConflict 输出文件已存在时的处理方式，为空时报错
+	OnConflict ConflictPolicy
+	// Preserve 从加密文件复制到输出的属性
+	Preserve Preserve
+	// Filter 选择要解密的文件。递归模式下 FilePattern 作为额外的 Include 模式
+	Filter Filter
 }
 
 // BatchDecrypt 批量解密文件
 func BatchDecrypt(options BatchDecryptOptions) error {
 	results := NewDecryptResults()
+	decryptOptions := DecryptOptions{Jobs: options.Jobs, OnConflict: options.OnConflict, Preserve: options.Preserve, Filter: options.Filter}
 
 	if options.Recursive {
-		dirResults, err := DecryptDirectory(options.InputDir, options.OutputDir, options.Config)
+		if options.FilePattern != "" {
+			decryptOptions.Filter.Include = append(append([]string(nil), options.Filter.Include...), options.FilePattern)
+		}
+		dirResults, err := DecryptDirectoryWithOptions(context.Background(), options.InputDir, options.OutputDir, options.Config, decryptOptions)
 		if err != nil {
 			return err
 		}
@@ -337,6 +570,7 @@ func BatchDecrypt(options BatchDecryptOptions) error {
 		results.TotalFiles = dirResults.TotalFiles
 		results.SuccessCount = dirResults.SuccessCount
 		results.FailedCount = dirResults.FailedCount
+		results.SkippedCount = dirResults.SkippedCount
 		return nil
 	}
 
@@ -346,12 +580,21 @@ func BatchDecrypt(options BatchDecryptOptions) error {
 		return err
 	}
 
+	config, err := withCredentials(options.Config)
+	if err != nil {
+		return err
+	}
+
 	fmt.Printf("找到 %d 个匹配文件\n", len(files))
 
+	pool := newDecryptPool(context.Background(), decryptOptions, config, results)
 	for i, file := range files {
 		if !IsEncryptedFile(file) {
 			continue
 		}
+		if info, err := os.Stat(file); err == nil && !options.Filter.Match(filepath.Base(file), info) {
+			continue
+		}
 
 		outputFile := filepath.Join(options.OutputDir, GenerateOutputFilename(file))
 
@@ -360,13 +603,84 @@ func BatchDecrypt(options BatchDecryptOptions) error {
 			options.ProgressFunc(int64(i), int64(len(files)))
 		}
 
-		// 执行解密并记录结果
-		result := decryptFileWithResult(file, outputFile, options.Config)
-		results.AddResult(result)
+		// 交给工作池解密并记录结果
+		pool.submit(file, outputFile)
 	}
+	pool.wait()
 
 	// 显示结果摘要（只在控制台打印，不保存到文件）
 	results.PrintSummary()
 
 	return nil
-}
\ No newline at end of file
+}
+
+// InspectFile 读取加密文件的头部信息，不需要凭据
+func InspectFile(inputFileName string) (*core.FileInfo, error) {
+	inputFile, err := os.Open(inputFileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input file: %v", err)
+	}
+	defer inputFile.Close()
+
+	info, err := core.InspectStream(inputFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	return info, nil
+}
+
+// VerifyCredentials 只读取文件头部验证凭据；inputPath 为目录时检查其中第一个 CSEnc 文件，
+// 返回实际检查的文件名
+func VerifyCredentials(inputPath string, config core.DecryptConfig) (string, error) {
+	return VerifyCredentialsWithFilter(inputPath, config, Filter{})
+}
+
+// VerifyCredentialsWithFilter 与 VerifyCredentials 相同，inputPath 为目录时只考虑通过 filter 的文件
+func VerifyCredentialsWithFilter(inputPath string, config core.DecryptConfig, filter Filter) (string, error) {
+	info, err := os.Stat(inputPath)
+	if err != nil {
+		return inputPath, fmt.Errorf("cannot access file: %v", err)
+	}
+
+	checkedFile := inputPath
+	if info.IsDir() {
+		checkedFile, err = firstEncryptedFile(inputPath, filter)
+		if err != nil {
+			return inputPath, err
+		}
+	}
+
+	inputFile, err := os.Open(checkedFile)
+	if err != nil {
+		return checkedFile, fmt.Errorf("failed to open input file: %v", err)
+	}
+	defer inputFile.Close()
+
+	if err := core.CheckCredentials(inputFile, config); err != nil {
+		return checkedFile, fmt.Errorf("credential check failed: %w", err)
+	}
+	return checkedFile, nil
+}
+
+// errStopWalk 用于提前结束目录遍历
+var errStopWalk = errors.New("stop walk")
+
+// firstEncryptedFile 返回目录中按遍历顺序第一个通过 filter 且头部是 CSEnc 格式的普通文件，
+// 跳过 .DS_Store、@eaDir 缩略图等未加密的文件
+func firstEncryptedFile(dir string, filter Filter) (string, error) {
+	var found string
+	err := walkDirectory(context.Background(), dir, filter, nil, func(path, relPath string, info os.FileInfo) error {
+		if info.Mode().IsRegular() && sniffHeader(path) == nil {
+			found = path
+			return errStopWalk
+		}
+		return nil
+	})
+	if err != nil && err != errStopWalk {
+		return "", err
+	}
+	if found == "" {
+		return "", fmt.Errorf("no encrypted files found in directory: %s", dir)
+	}
+	return found, nil
+}
@@ -0,0 +1,765 @@
+package files
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/synology-cloud-sync-decrypt-tool/syndecrypt-go/pkg/core"
+	"github.com/synology-cloud-sync-decrypt-tool/syndecrypt-go/pkg/util"
+)
+
+// 测试辅助函数：生成 PEM 格式的密钥对
+func generateTestKeyPair(t *testing.T) (privatePEM, publicPEM []byte) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey() error = %v", err)
+	}
+
+	privatePEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	publicPEM = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+	return privatePEM, publicPEM
+}
+
+// 测试辅助函数：创建包含指定文件的 zip
+func writeTestZip(t *testing.T, entries map[string][]byte) string {
+	t.Helper()
+
+	zipFile := filepath.Join(t.TempDir(), "key.zip")
+	file, err := os.Create(zipFile)
+	if err != nil {
+		t.Fatalf("failed to create zip: %v", err)
+	}
+	defer file.Close()
+
+	writer := zip.NewWriter(file)
+	for name, data := range entries {
+		entry, err := writer.Create(name)
+		if err != nil {
+			t.Fatalf("failed to add %s: %v", name, err)
+		}
+		entry.Write(data)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close zip: %v", err)
+	}
+	return zipFile
+}
+
+// 测试辅助函数：用密码加密数据并写入文件
+func writeEncryptedFile(t *testing.T, path string, plaintext, password []byte) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create input: %v", err)
+	}
+	defer file.Close()
+	if err := core.EncryptStream(bytes.NewReader(plaintext), file, core.EncryptConfig{Password: password}); err != nil {
+		t.Fatalf("EncryptStream() error = %v", err)
+	}
+}
+
+func TestLoadKeyPairFromZip(t *testing.T) {
+	privatePEM, publicPEM := generateTestKeyPair(t)
+
+	tests := []struct {
+		name    string
+		entries map[string][]byte
+		wantErr bool
+	}{
+		{
+			name:    "synology export",
+			entries: map[string][]byte{"private.pem": privatePEM, "public.pem": publicPEM},
+		},
+		{
+			name:    "nested and renamed",
+			entries: map[string][]byte{"keys/a.pem": privatePEM, "keys/b.pem": publicPEM},
+		},
+		{
+			name:    "missing public key",
+			entries: map[string][]byte{"private.pem": privatePEM},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			privateKey, publicKey, err := LoadKeyPairFromZip(writeTestZip(t, tt.entries))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadKeyPairFromZip() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (string(privateKey) != string(privatePEM) || string(publicKey) != string(publicPEM)) {
+				t.Error("LoadKeyPairFromZip() returned wrong keys")
+			}
+		})
+	}
+}
+
+func TestDecryptFileErrorKinds(t *testing.T) {
+	dir := t.TempDir()
+	inputFile := filepath.Join(dir, "encrypted.txt")
+	writeEncryptedFile(t, inputFile, []byte("hello"), []byte("right"))
+
+	outputFile := filepath.Join(dir, "out", "plain.txt")
+	err := DecryptFile(inputFile, outputFile, core.DecryptConfig{Password: []byte("wrong")})
+	if !errors.Is(err, core.ErrWrongPassword) {
+		t.Fatalf("DecryptFile() error = %v, want core.ErrWrongPassword", err)
+	}
+	if _, statErr := os.Stat(outputFile); !os.IsNotExist(statErr) {
+		t.Error("partial output was not removed")
+	}
+}
+
+func TestDecryptContextCanceled(t *testing.T) {
+	inputDir := t.TempDir()
+	inputFile := filepath.Join(inputDir, "encrypted.txt")
+	writeEncryptedFile(t, inputFile, []byte("hello"), []byte("pw"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	config := core.DecryptConfig{Password: []byte("pw")}
+
+	outputDir := t.TempDir()
+	outputFile := filepath.Join(outputDir, "plain.txt")
+	if err := DecryptFileContext(ctx, inputFile, outputFile, config); !errors.Is(err, context.Canceled) {
+		t.Errorf("DecryptFileContext() error = %v, want context.Canceled", err)
+	}
+	if _, err := os.Stat(outputFile); !os.IsNotExist(err) {
+		t.Error("output file should not exist after cancellation")
+	}
+
+	results, err := DecryptDirectoryContext(ctx, inputDir, outputDir, config)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("DecryptDirectoryContext() error = %v, want context.Canceled", err)
+	}
+	if results.TotalFiles != 0 {
+		t.Errorf("TotalFiles = %d, want 0", results.TotalFiles)
+	}
+}
+
+func TestDecryptDirectoryJobs(t *testing.T) {
+	password := []byte("pw")
+	inputDir := t.TempDir()
+	for i := 0; i < 20; i++ {
+		name := filepath.Join(inputDir, fmt.Sprintf("dir%d", i%3), fmt.Sprintf("file%02d.txt.cse", i))
+		writeEncryptedFile(t, name, bytes.Repeat([]byte{byte(i)}, 1000*i), password)
+	}
+	// 无法解密的文件，以及两个映射到同一输出的文件
+	os.WriteFile(filepath.Join(inputDir, "dir0", "broken.cse"), []byte("not encrypted"), 0644)
+	writeEncryptedFile(t, filepath.Join(inputDir, "dup.txt"), []byte("first"), password)
+	writeEncryptedFile(t, filepath.Join(inputDir, "dup.txt.cse"), []byte("second"), password)
+
+	var want []DecryptResult
+	for _, jobs := range []int{1, 8} {
+		results, err := DecryptDirectoryWithOptions(context.Background(), inputDir, t.TempDir(), core.DecryptConfig{Password: password}, DecryptOptions{Jobs: jobs})
+		if err != nil {
+			t.Fatalf("jobs=%d: DecryptDirectoryWithOptions() error = %v", jobs, err)
+		}
+		if results.TotalFiles != 23 || results.FailedCount != 2 {
+			t.Fatalf("jobs=%d: total %d, failed %d, want 23 and 2", jobs, results.TotalFiles, results.FailedCount)
+		}
+
+		if want == nil {
+			want = results.Results
+			continue
+		}
+		for i := range want {
+			if results.Results[i].InputFile != want[i].InputFile || results.Results[i].Success != want[i].Success {
+				t.Errorf("jobs=%d: result %d = %s (%v), want %s (%v)", jobs, i,
+					results.Results[i].InputFile, results.Results[i].Success, want[i].InputFile, want[i].Success)
+			}
+		}
+	}
+}
+
+func TestDecryptFileOnConflict(t *testing.T) {
+	password := []byte("pw")
+	plaintext := []byte("decrypted content")
+	inputFile := filepath.Join(t.TempDir(), "file.txt.cse")
+	writeEncryptedFile(t, inputFile, plaintext, password)
+
+	tests := []struct {
+		name        string
+		policy      ConflictPolicy
+		existing    []byte
+		wantErr     error
+		wantSkipped bool
+		// wantPath 为实际输出相对于请求路径的文件名
+		wantPath     string
+		wantExisting []byte
+	}{
+		{name: "fail", policy: ConflictFail, existing: []byte("old"), wantErr: ErrOutputExists, wantPath: "file.txt", wantExisting: []byte("old")},
+		{name: "default fails", existing: []byte("old"), wantErr: ErrOutputExists, wantPath: "file.txt", wantExisting: []byte("old")},
+		{name: "skip", policy: ConflictSkip, existing: []byte("old"), wantSkipped: true, wantPath: "file.txt", wantExisting: []byte("old")},
+		{name: "overwrite", policy: ConflictOverwrite, existing: []byte("old"), wantPath: "file.txt", wantExisting: plaintext},
+		{name: "rename", policy: ConflictRename, existing: []byte("old"), wantPath: "file (1).txt", wantExisting: []byte("old")},
+		{name: "skip-if-same same", policy: ConflictSkipIfSame, existing: plaintext, wantSkipped: true, wantPath: "file.txt", wantExisting: plaintext},
+		{name: "skip-if-same different", policy: ConflictSkipIfSame, existing: []byte("decrypted contenT"), wantPath: "file.txt", wantExisting: plaintext},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			outputFile := filepath.Join(dir, "file.txt")
+			os.WriteFile(outputFile, tt.existing, 0644)
+
+			output, err := DecryptFileWithOptions(context.Background(), inputFile, outputFile, core.DecryptConfig{Password: password}, DecryptOptions{OnConflict: tt.policy})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DecryptFileWithOptions() error = %v, want %v", err, tt.wantErr)
+			}
+			if output.Skipped != tt.wantSkipped {
+				t.Errorf("Skipped = %v, want %v", output.Skipped, tt.wantSkipped)
+			}
+			if want := filepath.Join(dir, tt.wantPath); output.Path != want {
+				t.Errorf("Path = %s, want %s", output.Path, want)
+			}
+			if got, _ := os.ReadFile(outputFile); !bytes.Equal(got, tt.wantExisting) {
+				t.Errorf("existing output = %q, want %q", got, tt.wantExisting)
+			}
+			if tt.policy == ConflictRename {
+				if got, _ := os.ReadFile(output.Path); !bytes.Equal(got, plaintext) {
+					t.Errorf("renamed output = %q, want %q", got, plaintext)
+				}
+			}
+		})
+	}
+}
+
+func TestParseConflictPolicy(t *testing.T) {
+	for _, s := range []string{"", "skip", "overwrite", "rename", "fail", "skip-if-same"} {
+		if _, err := ParseConflictPolicy(s); err != nil {
+			t.Errorf("ParseConflictPolicy(%q) error = %v", s, err)
+		}
+	}
+	if _, err := ParseConflictPolicy("replace"); err == nil {
+		t.Error("ParseConflictPolicy(\"replace\") should fail")
+	}
+}
+
+func TestDecryptFileAtomicOutput(t *testing.T) {
+	password := []byte("pw")
+	inputFile := filepath.Join(t.TempDir(), "file.txt.cse")
+	writeEncryptedFile(t, inputFile, []byte("new content"), password)
+
+	tests := []struct {
+		name     string
+		password []byte
+		want     []byte
+	}{
+		// 解密失败时已有输出保持不变
+		{name: "failed", password: []byte("wrong"), want: []byte("old content")},
+		{name: "succeeded", password: password, want: []byte("new content")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			outputFile := filepath.Join(dir, "file.txt")
+			os.WriteFile(outputFile, []byte("old content"), 0644)
+
+			DecryptFileWithOptions(context.Background(), inputFile, outputFile, core.DecryptConfig{Password: tt.password}, DecryptOptions{OnConflict: ConflictOverwrite})
+			if got, _ := os.ReadFile(outputFile); !bytes.Equal(got, tt.want) {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+
+			// 不留下临时文件
+			entries, _ := os.ReadDir(dir)
+			for _, entry := range entries {
+				if entry.Name() != "file.txt" {
+					t.Errorf("unexpected file %s", entry.Name())
+				}
+			}
+		})
+	}
+}
+
+func TestDecryptDirectoryPreserve(t *testing.T) {
+	password := []byte("pw")
+	inputDir := t.TempDir()
+	subDir := filepath.Join(inputDir, "sub")
+	inputFile := filepath.Join(subDir, "file.txt.cse")
+	writeEncryptedFile(t, inputFile, []byte("hello"), password)
+
+	atime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	mtime := time.Date(2002, 3, 4, 5, 6, 7, 0, time.UTC)
+	for _, path := range []string{inputFile, subDir} {
+		os.Chmod(path, 0750)
+	}
+	if util.CanChown() {
+		os.Chown(inputFile, 1234, 5678)
+	}
+
+	tests := []struct {
+		name     string
+		preserve Preserve
+	}{
+		{name: "none"},
+		{name: "times", preserve: Preserve{Times: true}},
+		{name: "all", preserve: Preserve{Times: true, Mode: true, Owner: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 上一次解密读取文件时可能已更新访问时间
+			for _, path := range []string{inputFile, subDir} {
+				os.Chtimes(path, atime, mtime)
+			}
+
+			outputDir := t.TempDir()
+			results, err := DecryptDirectoryWithOptions(context.Background(), inputDir, outputDir, core.DecryptConfig{Password: password}, DecryptOptions{Preserve: tt.preserve})
+			if err != nil || results.FailedCount != 0 {
+				t.Fatalf("DecryptDirectoryWithOptions() error = %v, failed %d", err, results.FailedCount)
+			}
+
+			for _, path := range []string{filepath.Join(outputDir, "sub", "file.txt"), filepath.Join(outputDir, "sub")} {
+				info, err := os.Stat(path)
+				if err != nil {
+					t.Fatalf("Stat() error = %v", err)
+				}
+				if got := info.ModTime().Equal(mtime); got != tt.preserve.Times {
+					t.Errorf("%s: mtime = %v, preserved %v, want %v", path, info.ModTime(), got, tt.preserve.Times)
+				}
+				if tt.preserve.Times && !util.FileAccessTime(info).Equal(atime) {
+					t.Errorf("%s: atime = %v, want %v", path, util.FileAccessTime(info), atime)
+				}
+				if got := info.Mode().Perm() == 0750; got != tt.preserve.Mode {
+					t.Errorf("%s: mode = %v, want preserved %v", path, info.Mode(), tt.preserve.Mode)
+				}
+			}
+
+			if tt.preserve.Owner && util.CanChown() {
+				info, _ := os.Stat(filepath.Join(outputDir, "sub", "file.txt"))
+				if uid, gid, _ := util.FileOwner(info); uid != 1234 || gid != 5678 {
+					t.Errorf("owner = %d:%d, want 1234:5678", uid, gid)
+				}
+			}
+		})
+	}
+}
+
+func TestDecryptPlan(t *testing.T) {
+	password := []byte("pw")
+	inputDir := t.TempDir()
+	writeEncryptedFile(t, filepath.Join(inputDir, "a.txt.cse"), []byte("a"), password)
+	writeEncryptedFile(t, filepath.Join(inputDir, "sub", "b.txt.enc"), []byte("b"), password)
+	os.WriteFile(filepath.Join(inputDir, "plain.txt"), []byte("not encrypted"), 0644)
+
+	outputDir := filepath.Join(t.TempDir(), "out")
+	existing := filepath.Join(outputDir, "a.txt")
+	os.MkdirAll(outputDir, 0755)
+	os.WriteFile(existing, []byte("old"), 0644)
+
+	tests := []struct {
+		policy  ConflictPolicy
+		want    PlanAction
+		wantOut string
+	}{
+		{policy: ConflictFail, want: PlanConflict, wantOut: "a.txt"},
+		{policy: ConflictSkip, want: PlanSkip, wantOut: "a.txt"},
+		{policy: ConflictOverwrite, want: PlanOverwrite, wantOut: "a.txt"},
+		{policy: ConflictRename, want: PlanRename, wantOut: "a (1).txt"},
+		{policy: ConflictSkipIfSame, want: PlanSkipIfSame, wantOut: "a.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			plan := NewDecryptPlan(DecryptOptions{OnConflict: tt.policy})
+			if err := plan.AddDirectory(context.Background(), inputDir, outputDir); err != nil {
+				t.Fatalf("AddDirectory() error = %v", err)
+			}
+			if plan.TotalFiles != 3 || plan.NotEncryptedCount != 1 {
+				t.Fatalf("total %d, not encrypted %d, want 3 and 1", plan.TotalFiles, plan.NotEncryptedCount)
+			}
+
+			actions := make(map[string]PlanEntry)
+			for _, entry := range plan.Entries {
+				actions[filepath.Base(entry.InputFile)] = entry
+			}
+			if got := actions["a.txt.cse"]; got.Action != tt.want || got.OutputFile != filepath.Join(outputDir, tt.wantOut) {
+				t.Errorf("a.txt.cse: %s -> %s, want %s -> %s", got.Action, got.OutputFile, tt.want, tt.wantOut)
+			}
+			if got := actions["b.txt.enc"]; got.Action != PlanDecrypt || got.OutputFile != filepath.Join(outputDir, "sub", "b.txt") {
+				t.Errorf("b.txt.enc: %s -> %s, want decrypt -> sub/b.txt", got.Action, got.OutputFile)
+			}
+			if got := actions["plain.txt"]; got.Action != PlanNotEncrypted || !strings.Contains(got.Error, "header") {
+				t.Errorf("plain.txt: %s (%s), want not-encrypted", got.Action, got.Error)
+			}
+
+			var wantBytes int64
+			for _, entry := range plan.Entries {
+				if entry.decrypts() {
+					wantBytes += entry.Size
+				}
+			}
+			if plan.TotalBytes != wantBytes || plan.TotalBytes == 0 {
+				t.Errorf("TotalBytes = %d, want %d", plan.TotalBytes, wantBytes)
+			}
+		})
+	}
+
+	// 试运行不写入任何文件
+	entries, _ := os.ReadDir(outputDir)
+	if len(entries) != 1 {
+		t.Errorf("output directory has %d entries, want 1", len(entries))
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{err: nil, want: ""},
+		{err: fmt.Errorf("decryption failed: %w", core.ErrWrongPassword), want: "wrong_password"},
+		{err: fmt.Errorf("decryption failed: %w", &core.DigestMismatchError{}), want: "integrity"},
+		{err: &core.UnsupportedVersionError{Major: 9}, want: "unsupported_version"},
+		{err: fmt.Errorf("%w: x", ErrOutputExists), want: "output_exists"},
+		{err: context.Canceled, want: "canceled"},
+		{err: errors.New("disk full"), want: "other"},
+	}
+
+	for _, tt := range tests {
+		if got := ErrorClass(tt.err); got != tt.want {
+			t.Errorf("ErrorClass(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestDecryptResultsWriteReport(t *testing.T) {
+	password := []byte("pw")
+	inputDir := t.TempDir()
+	writeEncryptedFile(t, filepath.Join(inputDir, "a.txt.cse"), []byte("hello"), password)
+	os.WriteFile(filepath.Join(inputDir, "b.txt"), []byte("not encrypted"), 0644)
+
+	results, err := DecryptDirectory(inputDir, t.TempDir(), core.DecryptConfig{Password: password})
+	if err != nil {
+		t.Fatalf("DecryptDirectory() error = %v", err)
+	}
+
+	var csvReport bytes.Buffer
+	if err := results.WriteReport(&csvReport, ReportCSV); err != nil {
+		t.Fatalf("WriteReport(csv) error = %v", err)
+	}
+	records, err := csv.NewReader(&csvReport).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("CSV has %d rows, want header and 2 results", len(records))
+	}
+	if got := records[1][2] + "," + records[1][7]; got != "success,verified" {
+		t.Errorf("a.txt.cse: status,digest = %s, want success,verified", got)
+	}
+	if got := records[2][2] + "," + records[2][5]; got != "failed,corrupt_header" {
+		t.Errorf("b.txt: status,class = %s, want failed,corrupt_header", got)
+	}
+
+	var jsonReport bytes.Buffer
+	if err := results.WriteReport(&jsonReport, ReportJSON); err != nil {
+		t.Fatalf("WriteReport(json) error = %v", err)
+	}
+	var decoded DecryptResults
+	if err := json.Unmarshal(jsonReport.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(decoded.Results) != 2 || decoded.Results[1].ErrorClass != "corrupt_header" {
+		t.Errorf("JSON results = %+v", decoded.Results)
+	}
+
+	var textReport bytes.Buffer
+	if err := results.WriteReport(&textReport, ReportText); err != nil {
+		t.Fatalf("WriteReport(text) error = %v", err)
+	}
+	if !strings.Contains(textReport.String(), "corrupt_header") {
+		t.Error("text report does not include the error class")
+	}
+}
+
+func TestDecryptDirectoryFailFast(t *testing.T) {
+	password := []byte("pw")
+	inputDir := t.TempDir()
+	os.WriteFile(filepath.Join(inputDir, "a_broken.cse"), []byte("not encrypted"), 0644)
+	for i := 0; i < 10; i++ {
+		writeEncryptedFile(t, filepath.Join(inputDir, fmt.Sprintf("file%02d.txt.cse", i)), []byte("hello"), password)
+	}
+
+	for _, jobs := range []int{1, 4} {
+		options := DecryptOptions{Jobs: jobs, FailFast: true}
+		results, err := DecryptDirectoryWithOptions(context.Background(), inputDir, t.TempDir(), core.DecryptConfig{Password: password}, options)
+		if !errors.Is(err, ErrFailFast) {
+			t.Fatalf("jobs=%d: DecryptDirectoryWithOptions() error = %v, want ErrFailFast", jobs, err)
+		}
+		if results.FailedCount != 1 {
+			t.Errorf("jobs=%d: failed %d, want 1", jobs, results.FailedCount)
+		}
+		// 顺序解密时第一个文件失败后不再处理其他文件
+		if jobs == 1 && results.TotalFiles != 1 {
+			t.Errorf("jobs=1: total %d, want 1", results.TotalFiles)
+		}
+	}
+
+	// 没有失败时与普通解密相同
+	os.Remove(filepath.Join(inputDir, "a_broken.cse"))
+	results, err := DecryptDirectoryWithOptions(context.Background(), inputDir, t.TempDir(), core.DecryptConfig{Password: password}, DecryptOptions{FailFast: true})
+	if err != nil || results.SuccessCount != 10 {
+		t.Errorf("DecryptDirectoryWithOptions() = %d succeeded, error %v, want 10 and nil", results.SuccessCount, err)
+	}
+}
+
+func TestLoadPasswordFromFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{name: "no newline", content: "secret", want: "secret"},
+		{name: "newline", content: "secret\n", want: "secret"},
+		{name: "crlf", content: "secret\r\n", want: "secret"},
+		{name: "only last newline", content: "secret\n\n", want: "secret\n"},
+		{name: "spaces kept", content: " secret \n", want: " secret "},
+		{name: "empty", content: "\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			passwordFile := filepath.Join(t.TempDir(), "password.txt")
+			os.WriteFile(passwordFile, []byte(tt.content), 0600)
+
+			got, err := LoadPasswordFromFile(passwordFile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadPasswordFromFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("LoadPasswordFromFile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// testFileInfo 过滤测试使用的文件信息
+type testFileInfo struct {
+	os.FileInfo
+	size    int64
+	modTime time.Time
+}
+
+func (i testFileInfo) Size() int64        { return i.size }
+func (i testFileInfo) ModTime() time.Time { return i.modTime }
+
+func TestFilterMatch(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	info := testFileInfo{size: 1000, modTime: now}
+
+	tests := []struct {
+		name    string
+		filter  Filter
+		relPath string
+		want    bool
+	}{
+		{name: "empty filter", relPath: "a/b.txt.cse", want: true},
+		{name: "base name pattern at any depth", filter: Filter{Include: []string{"*.jpg.cse"}}, relPath: "2024/05/photo.jpg.cse", want: true},
+		{name: "base name pattern no match", filter: Filter{Include: []string{"*.jpg.cse"}}, relPath: "2024/notes.txt.cse", want: false},
+		{name: "any include matches", filter: Filter{Include: []string{"*.png.cse", "*.jpg.cse"}}, relPath: "photo.jpg.cse", want: true},
+		{name: "path pattern", filter: Filter{Include: []string{"2024/*/*.cse"}}, relPath: "2024/05/photo.jpg.cse", want: true},
+		{name: "path pattern is anchored", filter: Filter{Include: []string{"05/*.cse"}}, relPath: "2024/05/photo.jpg.cse", want: false},
+		{name: "double star any depth", filter: Filter{Include: []string{"photos/**/*.cse"}}, relPath: "photos/2024/05/a.cse", want: true},
+		{name: "double star zero directories", filter: Filter{Include: []string{"photos/**/*.cse"}}, relPath: "photos/a.cse", want: true},
+		{name: "leading double star", filter: Filter{Include: []string{"**/raw/*"}}, relPath: "raw/a.cse", want: true},
+		{name: "exclude wins over include", filter: Filter{Include: []string{"*.cse"}, Exclude: []string{"tmp/**"}}, relPath: "tmp/a.cse", want: false},
+		{name: "exclude base name", filter: Filter{Exclude: []string{"Thumbs.db*"}}, relPath: "a/Thumbs.db.cse", want: false},
+		{name: "min size", filter: Filter{MinSize: 1001}, relPath: "a.cse", want: false},
+		{name: "max size inclusive", filter: Filter{MaxSize: 1000}, relPath: "a.cse", want: true},
+		{name: "max size", filter: Filter{MaxSize: 999}, relPath: "a.cse", want: false},
+		{name: "newer than", filter: Filter{NewerThan: now.Add(-time.Hour)}, relPath: "a.cse", want: true},
+		{name: "not newer than", filter: Filter{NewerThan: now}, relPath: "a.cse", want: false},
+		{name: "older than", filter: Filter{OlderThan: now.Add(time.Hour)}, relPath: "a.cse", want: true},
+		{name: "not older than", filter: Filter{OlderThan: now}, relPath: "a.cse", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.filter.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			if got := tt.filter.Match(filepath.FromSlash(tt.relPath), info); got != tt.want {
+				t.Errorf("Match(%s) = %v, want %v", tt.relPath, got, tt.want)
+			}
+		})
+	}
+
+	for _, filter := range []Filter{
+		{Include: []string{"[a-"}},
+		{Exclude: []string{""}},
+		{MinSize: 10, MaxSize: 5},
+		{NewerThan: now, OlderThan: now},
+	} {
+		if err := filter.Validate(); err == nil {
+			t.Errorf("Validate(%+v) should fail", filter)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "512", want: 512},
+		{in: "100K", want: 100 << 10},
+		{in: "1.5M", want: 3 << 19},
+		{in: "2GiB", want: 2 << 30},
+		{in: "10 mb", want: 10 << 20},
+		{in: "", wantErr: true},
+		{in: "M", wantErr: true},
+		{in: "10X", wantErr: true},
+		{in: "-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseFilterTime(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{in: "2024-05-01", want: time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local)},
+		{in: "2024-05-01 08:30:00", want: time.Date(2024, 5, 1, 8, 30, 0, 0, time.Local)},
+		{in: "2024-05-01T08:30:00Z", want: time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC)},
+		{in: "7d", want: now.AddDate(0, 0, -7)},
+		{in: "2w", want: now.AddDate(0, 0, -14)},
+		{in: "90m", want: now.Add(-90 * time.Minute)},
+		{in: "yesterday", wantErr: true},
+		{in: "-1h", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseFilterTime(tt.in, now)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("ParseFilterTime(%q) = %v, %v, want %v (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestDecryptDirectoryFilter(t *testing.T) {
+	password := []byte("pw")
+	inputDir := t.TempDir()
+	for _, name := range []string{"a.jpg.cse", "docs/b.txt.cse", "photos/c.jpg.cse", "photos/@eaDir/d.jpg.cse"} {
+		writeEncryptedFile(t, filepath.Join(inputDir, filepath.FromSlash(name)), []byte(name), password)
+	}
+
+	options := DecryptOptions{Jobs: 2, Filter: Filter{Include: []string{"*.jpg.cse"}, Exclude: []string{"@eaDir"}}}
+	want := []string{"a.jpg", filepath.Join("photos", "c.jpg")}
+
+	// 目录解密和试运行使用同一套过滤规则
+	plan := NewDecryptPlan(options)
+	outputDir := t.TempDir()
+	if err := plan.AddDirectory(context.Background(), inputDir, outputDir); err != nil {
+		t.Fatalf("AddDirectory() error = %v", err)
+	}
+	var planned []string
+	for _, entry := range plan.Entries {
+		rel, _ := filepath.Rel(outputDir, entry.OutputFile)
+		planned = append(planned, rel)
+	}
+	if strings.Join(planned, ",") != strings.Join(want, ",") {
+		t.Errorf("plan outputs = %v, want %v", planned, want)
+	}
+
+	results, err := DecryptDirectoryWithOptions(context.Background(), inputDir, outputDir, core.DecryptConfig{Password: password}, options)
+	if err != nil {
+		t.Fatalf("DecryptDirectoryWithOptions() error = %v", err)
+	}
+	if results.TotalFiles != len(want) || results.SuccessCount != len(want) {
+		t.Errorf("total %d, success %d, want %d", results.TotalFiles, results.SuccessCount, len(want))
+	}
+
+	var written []string
+	filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(outputDir, path)
+			written = append(written, rel)
+		}
+		return nil
+	})
+	if strings.Join(written, ",") != strings.Join(want, ",") {
+		t.Errorf("written = %v, want %v", written, want)
+	}
+	// 被排除的目录整个跳过，不会创建
+	if _, err := os.Stat(filepath.Join(outputDir, "photos", "@eaDir")); !os.IsNotExist(err) {
+		t.Errorf("excluded directory was created: %v", err)
+	}
+}
+
+func TestVerifyCredentialsDirectory(t *testing.T) {
+	password := []byte("pw")
+	dir := t.TempDir()
+	// 按遍历顺序排在加密文件之前的未加密文件
+	os.WriteFile(filepath.Join(dir, ".DS_Store"), []byte("not encrypted"), 0644)
+	os.MkdirAll(filepath.Join(dir, "@eaDir"), 0755)
+	os.WriteFile(filepath.Join(dir, "@eaDir", "thumb.jpg"), []byte("not encrypted"), 0644)
+	writeEncryptedFile(t, filepath.Join(dir, "a.txt.cse"), []byte("a"), password)
+	writeEncryptedFile(t, filepath.Join(dir, "b.jpg.cse"), []byte("b"), password)
+
+	tests := []struct {
+		name     string
+		password []byte
+		filter   Filter
+		want     string
+		wantErr  error
+	}{
+		{name: "skips unencrypted files", password: password, want: "a.txt.cse"},
+		{name: "wrong password", password: []byte("wrong"), want: "a.txt.cse", wantErr: core.ErrWrongPassword},
+		{name: "filter", password: password, filter: Filter{Include: []string{"*.jpg.cse"}}, want: "b.jpg.cse"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checked, err := VerifyCredentialsWithFilter(dir, core.DecryptConfig{Password: tt.password}, tt.filter)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifyCredentialsWithFilter() error = %v, want %v", err, tt.wantErr)
+			}
+			if filepath.Base(checked) != tt.want {
+				t.Errorf("checked %s, want %s", checked, tt.want)
+			}
+		})
+	}
+
+	// 目录中没有加密文件
+	if _, err := VerifyCredentialsWithFilter(dir, core.DecryptConfig{Password: password}, Filter{Include: []string{"*.png.cse"}}); err == nil {
+		t.Error("VerifyCredentialsWithFilter() should fail when no file matches")
+	}
+}
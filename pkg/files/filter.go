@@ -0,0 +1,222 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter 选择目录中要解密的文件，所有遍历方式（目录解密、批量解密、试运行）共用。
+// 模式使用 / 分隔的相对路径匹配，语法同 path.Match，另外 ** 匹配任意层目录；
+// 不含 / 的模式只匹配文件名，例如 *.jpg 匹配任意深度的 jpg 文件
+type Filter struct {
+	// Include 文件至少匹配其中一个模式时才解密，为空时包含所有文件
+	Include []string
+	// Exclude 匹配任一模式的文件不解密，优先于 Include；匹配的目录整个跳过
+	Exclude []string
+	// MinSize、MaxSize 加密文件大小的范围（字节，包含边界），0 表示不限
+	MinSize int64
+	MaxSize int64
+	// NewerThan、OlderThan 加密文件修改时间的范围，零值表示不限
+	NewerThan time.Time
+	OlderThan time.Time
+}
+
+// Validate 检查模式语法和范围
+func (f Filter) Validate() error {
+	for _, patterns := range [][]string{f.Include, f.Exclude} {
+		for _, pattern := range patterns {
+			if pattern == "" {
+				return fmt.Errorf("empty filter pattern")
+			}
+			for _, segment := range strings.Split(pattern, "/") {
+				if _, err := path.Match(segment, ""); err != nil {
+					return fmt.Errorf("invalid filter pattern %q: %v", pattern, err)
+				}
+			}
+		}
+	}
+	if f.MinSize < 0 || f.MaxSize < 0 {
+		return fmt.Errorf("file size limits must not be negative")
+	}
+	if f.MaxSize > 0 && f.MinSize > f.MaxSize {
+		return fmt.Errorf("minimum file size %d is larger than maximum %d", f.MinSize, f.MaxSize)
+	}
+	if !f.NewerThan.IsZero() && !f.OlderThan.IsZero() && !f.NewerThan.Before(f.OlderThan) {
+		return fmt.Errorf("newer-than time must be before older-than time")
+	}
+	return nil
+}
+
+// Match 判断目录中的文件是否要解密，relPath 为相对于遍历根目录的路径
+func (f Filter) Match(relPath string, info os.FileInfo) bool {
+	relPath = filepath.ToSlash(relPath)
+	if matchAny(f.Exclude, relPath) {
+		return false
+	}
+	if len(f.Include) > 0 && !matchAny(f.Include, relPath) {
+		return false
+	}
+
+	size := info.Size()
+	if f.MinSize > 0 && size < f.MinSize {
+		return false
+	}
+	if f.MaxSize > 0 && size > f.MaxSize {
+		return false
+	}
+
+	modTime := info.ModTime()
+	if !f.NewerThan.IsZero() && !modTime.After(f.NewerThan) {
+		return false
+	}
+	if !f.OlderThan.IsZero() && !modTime.Before(f.OlderThan) {
+		return false
+	}
+	return true
+}
+
+// skipDir 判断是否整个跳过目录：目录本身匹配某个 Exclude 模式，
+// 例如 @eaDir 或 cache/**
+func (f Filter) skipDir(relPath string) bool {
+	return matchAny(f.Exclude, filepath.ToSlash(relPath))
+}
+
+// matchAny 判断 relPath 是否匹配任一模式
+func matchAny(patterns []string, relPath string) bool {
+	for _, pattern := range patterns {
+		if matchPattern(pattern, relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPattern 按 / 分段匹配，不含 / 的模式只匹配最后一段
+func matchPattern(pattern, relPath string) bool {
+	if !strings.Contains(pattern, "/") {
+		matched, _ := path.Match(pattern, path.Base(relPath))
+		return matched
+	}
+	return matchSegments(strings.Split(strings.TrimPrefix(pattern, "/"), "/"), strings.Split(relPath, "/"))
+}
+
+// matchSegments 逐段匹配，** 匹配零个或多个目录
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], name[0]); !matched {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// walkDirectory 遍历目录，对通过 filter 的普通文件和符号链接调用 visitFile，
+// 对未被排除的子目录（不含根目录）调用 visitDir。ctx 取消时停止遍历
+func walkDirectory(ctx context.Context, root string, filter Filter, visitDir, visitFile func(path, relPath string, info os.FileInfo) error) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// 计算相对路径
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if relPath == "." {
+				return nil
+			}
+			if filter.skipDir(relPath) {
+				return filepath.SkipDir
+			}
+			if visitDir != nil {
+				return visitDir(path, relPath, info)
+			}
+			return nil
+		}
+
+		if !filter.Match(relPath, info) {
+			return nil
+		}
+		return visitFile(path, relPath, info)
+	})
+}
+
+// sizeUnits 文件大小的单位，均以 1024 为进制
+var sizeUnits = map[string]int64{
+	"":  1,
+	"b": 1,
+	"k": 1 << 10, "kb": 1 << 10, "kib": 1 << 10,
+	"m": 1 << 20, "mb": 1 << 20, "mib": 1 << 20,
+	"g": 1 << 30, "gb": 1 << 30, "gib": 1 << 30,
+	"t": 1 << 40, "tb": 1 << 40, "tib": 1 << 40,
+}
+
+// ParseSize 解析文件大小，例如 512、100K、1.5M、2GiB，单位以 1024 为进制
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	end := len(s)
+	for end > 0 && !(s[end-1] >= '0' && s[end-1] <= '9') {
+		end--
+	}
+	unit, ok := sizeUnits[strings.ToLower(strings.TrimSpace(s[end:]))]
+	if !ok {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	n, err := strconv.ParseFloat(s[:end], 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// timeLayouts ParseFilterTime 接受的绝对时间格式，不带时区时使用本地时间
+var timeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+// ParseFilterTime 解析修改时间条件：绝对时间（2024-05-01、2024-05-01 12:00:00、RFC 3339）
+// 或相对于 now 的时长，例如 90m、12h、7d、2w 表示 now 之前的这段时间
+func ParseFilterTime(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	// 天和周不是 time.ParseDuration 的单位，单独处理
+	days := map[byte]int{'d': 1, 'w': 7}
+	if len(s) > 1 {
+		if perUnit, ok := days[s[len(s)-1]]; ok {
+			if n, err := strconv.Atoi(s[:len(s)-1]); err == nil && n >= 0 {
+				return now.AddDate(0, 0, -n*perUnit), nil
+			}
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %s (want a date such as 2024-05-01 or an age such as 7d)", s)
+}
@@ -0,0 +1,130 @@
+package files
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// maxRenameAttempts 限制 rename 策略尝试的文件名数量
+const maxRenameAttempts = 10000
+
+// tempOutputSuffix 未完成输出的临时文件后缀
+const tempOutputSuffix = ".syndecrypt-tmp"
+
+// pendingOutput 未完成的输出。数据先写入同一目录下的隐藏临时文件，
+// commit 时 fsync 并改名为最终路径，因此中途崩溃或被终止不会在最终路径
+// 留下看似完整的截断文件
+type pendingOutput struct {
+	*os.File
+	// path 请求的输出路径
+	path string
+	plan outputPlan
+	done bool
+}
+
+// createOutput 在输出路径所在目录创建隐藏的临时文件
+func createOutput(outputFileName string, plan outputPlan) (*pendingOutput, error) {
+	dir, base := filepath.Split(outputFileName)
+	for i := 0; i < maxRenameAttempts; i++ {
+		var random [6]byte
+		if _, err := rand.Read(random[:]); err != nil {
+			return nil, fmt.Errorf("failed to create output file: %v", err)
+		}
+		tempName := filepath.Join(dir, "."+base+"."+hex.EncodeToString(random[:])+tempOutputSuffix)
+
+		file, err := os.OpenFile(tempName, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if err == nil {
+			return &pendingOutput{File: file, path: outputFileName, plan: plan}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create output file: %v", err)
+		}
+	}
+	return nil, fmt.Errorf("failed to create temporary file for %s", outputFileName)
+}
+
+// commit 把临时文件落盘并改名为最终路径，返回实际使用的路径。
+// overwrite 时直接替换已有文件；否则不覆盖任何已存在的文件，
+// 并发解密时也不会有两个文件写入同一个输出
+func (o *pendingOutput) commit() (string, error) {
+	if err := o.Sync(); err != nil {
+		o.abort()
+		return o.path, fmt.Errorf("failed to sync output file: %v", err)
+	}
+	if err := o.Close(); err != nil {
+		o.abort()
+		return o.path, fmt.Errorf("failed to close output file: %v", err)
+	}
+
+	if o.plan.overwrite {
+		if err := os.Rename(o.Name(), o.path); err != nil {
+			o.abort()
+			return o.path, fmt.Errorf("failed to rename output file: %v", err)
+		}
+		o.done = true
+		syncDir(filepath.Dir(o.path))
+		return o.path, nil
+	}
+
+	candidate := o.path
+	for n := 1; ; n++ {
+		err := renameNoReplace(o.Name(), candidate)
+		if err == nil {
+			o.done = true
+			syncDir(filepath.Dir(candidate))
+			return candidate, nil
+		}
+		if !os.IsExist(err) {
+			o.abort()
+			return candidate, fmt.Errorf("failed to rename output file: %v", err)
+		}
+		if !o.plan.rename {
+			o.abort()
+			return candidate, fmt.Errorf("%w: %s", ErrOutputExists, candidate)
+		}
+		if n > maxRenameAttempts {
+			o.abort()
+			return candidate, fmt.Errorf("no free output file name for %s", o.path)
+		}
+		candidate = renamedOutput(o.path, n)
+	}
+}
+
+// abort 关闭并删除临时文件，commit 成功后调用无效果
+func (o *pendingOutput) abort() {
+	if o.done {
+		return
+	}
+	o.done = true
+	o.Close()
+	os.Remove(o.Name())
+}
+
+// renameNoReplace 把 oldpath 改名为 newpath，newpath 已存在时返回 os.ErrExist。
+// 优先用硬链接保证原子性；文件系统不支持硬链接时退回到先检查再改名
+func renameNoReplace(oldpath, newpath string) error {
+	err := os.Link(oldpath, newpath)
+	if err == nil {
+		os.Remove(oldpath)
+		return nil
+	}
+	if os.IsExist(err) {
+		return err
+	}
+
+	if _, statErr := os.Lstat(newpath); statErr == nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrExist}
+	}
+	return os.Rename(oldpath, newpath)
+}
+
+// syncDir 尽力把目录项的修改落盘，部分平台不支持对目录 fsync，忽略错误
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
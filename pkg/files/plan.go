@@ -0,0 +1,224 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/synology-cloud-sync-decrypt-tool/syndecrypt-go/pkg/core"
+)
+
+// PlanAction 试运行时对一个文件的计划操作
+type PlanAction string
+
+const (
+	// PlanDecrypt 解密到新文件
+	PlanDecrypt PlanAction = "decrypt"
+	// PlanOverwrite 覆盖已有文件
+	PlanOverwrite PlanAction = "overwrite"
+	// PlanRename 保留已有文件，写入新的文件名
+	PlanRename PlanAction = "rename"
+	// PlanSkip 保留已有文件，不解密
+	PlanSkip PlanAction = "skip"
+	// PlanSkipIfSame 解密时与已有文件比较 file_md5，不同才覆盖
+	PlanSkipIfSame PlanAction = "skip-if-same"
+	// PlanConflict 输出已存在，解密时会失败
+	PlanConflict PlanAction = "conflict"
+	// PlanNotEncrypted 不是 CSEnc 文件，解密时会失败
+	PlanNotEncrypted PlanAction = "not-encrypted"
+)
+
+// PlanEntry 试运行计划中的一个文件
+type PlanEntry struct {
+	InputFile  string     `json:"input_file"`
+	OutputFile string     `json:"output_file"`
+	Action     PlanAction `json:"action"`
+	// Size 加密文件的大小，CSEnc 格式不记录明文大小
+	Size         int64  `json:"size"`
+	OutputExists bool   `json:"output_exists,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// decrypts 判断该文件是否会被解密
+func (e PlanEntry) decrypts() bool {
+	switch e.Action {
+	case PlanDecrypt, PlanOverwrite, PlanRename, PlanSkipIfSame:
+		return true
+	}
+	return false
+}
+
+// DecryptPlan 试运行计划：只遍历目录并读取文件头部，不写入任何文件
+type DecryptPlan struct {
+	Entries           []PlanEntry `json:"entries"`
+	TotalFiles        int         `json:"total_files"`
+	DecryptCount      int         `json:"decrypt_count"`
+	SkipCount         int         `json:"skip_count"`
+	ConflictCount     int         `json:"conflict_count"`
+	NotEncryptedCount int         `json:"not_encrypted_count"`
+	// TotalBytes 将要解密的加密文件总大小
+	TotalBytes int64 `json:"total_bytes"`
+
+	options DecryptOptions
+	// 已计划的输出路径，与工作池一样按加入顺序处理同名输出
+	outputs map[string]bool
+}
+
+// NewDecryptPlan 创建试运行计划，options.OnConflict 决定已有输出的处理方式
+func NewDecryptPlan(options DecryptOptions) *DecryptPlan {
+	return &DecryptPlan{
+		Entries: make([]PlanEntry, 0),
+		options: options,
+		outputs: make(map[string]bool),
+	}
+}
+
+// AddFile 把单个文件加入计划
+func (p *DecryptPlan) AddFile(inputFile, outputFile string) {
+	entry := PlanEntry{InputFile: inputFile, OutputFile: outputFile}
+
+	if info, err := os.Stat(inputFile); err != nil {
+		entry.Action = PlanNotEncrypted
+		entry.Error = fmt.Sprintf("cannot access file: %v", err)
+	} else {
+		entry.Size = info.Size()
+		if err := sniffHeader(inputFile); err != nil {
+			entry.Action = PlanNotEncrypted
+			entry.Error = err.Error()
+		}
+	}
+
+	claimed := p.outputs[outputFile]
+	p.outputs[outputFile] = true
+	entry.OutputExists = claimed || pathExists(outputFile)
+
+	if entry.Action == "" {
+		entry.Action = p.conflictAction(entry.OutputExists)
+		if entry.Action == PlanConflict {
+			entry.Error = fmt.Sprintf("%v: %s", ErrOutputExists, outputFile)
+		}
+		// 本次运行中已计划的同名输出不能覆盖或比较，与工作池一致
+		if claimed && (entry.Action == PlanOverwrite || entry.Action == PlanSkipIfSame) {
+			entry.Action = PlanConflict
+			entry.Error = fmt.Sprintf("%v: %s", ErrOutputExists, outputFile)
+		}
+		if entry.Action == PlanRename {
+			entry.OutputFile = p.renamedOutput(outputFile)
+			p.outputs[entry.OutputFile] = true
+		}
+	}
+
+	p.add(entry)
+}
+
+// AddDirectory 按 DecryptDirectory 的规则遍历目录并加入计划，只包含通过 options.Filter 的文件
+func (p *DecryptPlan) AddDirectory(ctx context.Context, inputDir, outputDir string) error {
+	return walkDirectory(ctx, inputDir, p.options.Filter, nil, func(path, relPath string, info os.FileInfo) error {
+		p.AddFile(path, directoryOutputPath(outputDir, relPath))
+		return nil
+	})
+}
+
+func (p *DecryptPlan) add(entry PlanEntry) {
+	p.Entries = append(p.Entries, entry)
+	p.TotalFiles++
+
+	switch {
+	case entry.decrypts():
+		p.DecryptCount++
+		p.TotalBytes += entry.Size
+	case entry.Action == PlanSkip:
+		p.SkipCount++
+	case entry.Action == PlanConflict:
+		p.ConflictCount++
+	case entry.Action == PlanNotEncrypted:
+		p.NotEncryptedCount++
+	}
+}
+
+// conflictAction 按冲突策略决定输出已存在时的操作
+func (p *DecryptPlan) conflictAction(exists bool) PlanAction {
+	if !exists {
+		return PlanDecrypt
+	}
+	switch p.options.OnConflict {
+	case ConflictSkip:
+		return PlanSkip
+	case ConflictOverwrite:
+		return PlanOverwrite
+	case ConflictRename:
+		return PlanRename
+	case ConflictSkipIfSame:
+		return PlanSkipIfSame
+	}
+	return PlanConflict
+}
+
+// renamedOutput 返回 rename 策略下第一个既不存在、也未被计划的文件名
+func (p *DecryptPlan) renamedOutput(outputFile string) string {
+	for n := 1; n <= maxRenameAttempts; n++ {
+		candidate := renamedOutput(outputFile, n)
+		if !p.outputs[candidate] && !pathExists(candidate) {
+			return candidate
+		}
+	}
+	return outputFile
+}
+
+// Print 以文本形式打印计划
+func (p *DecryptPlan) Print() {
+	fmt.Println("试运行计划（不会写入任何文件）")
+	for _, entry := range p.Entries {
+		switch entry.Action {
+		case PlanConflict, PlanNotEncrypted:
+			fmt.Printf("  %s %s - %s\n", planActionLabels[entry.Action], entry.InputFile, entry.Error)
+		case PlanSkip:
+			fmt.Printf("  %s %s (保留 %s)\n", planActionLabels[entry.Action], entry.InputFile, entry.OutputFile)
+		default:
+			fmt.Printf("  %s %s -> %s\n", planActionLabels[entry.Action], entry.InputFile, entry.OutputFile)
+		}
+	}
+
+	fmt.Println("\n" + strings.Repeat("=", 60))
+	fmt.Println("试运行摘要")
+	fmt.Println(strings.Repeat("=", 60))
+	fmt.Printf("总文件数: %d\n", p.TotalFiles)
+	fmt.Printf("将解密: %d\n", p.DecryptCount)
+	fmt.Printf("跳过: %d\n", p.SkipCount)
+	fmt.Printf("冲突: %d\n", p.ConflictCount)
+	fmt.Printf("非加密文件: %d\n", p.NotEncryptedCount)
+	fmt.Printf("加密数据总量: %d 字节\n", p.TotalBytes)
+	fmt.Println(strings.Repeat("=", 60))
+}
+
+// planActionLabels 文本输出中各操作的标记
+var planActionLabels = map[PlanAction]string{
+	PlanDecrypt:      "🔓 解密",
+	PlanOverwrite:    "♻️ 覆盖",
+	PlanRename:       "📝 改名",
+	PlanSkip:         "⏭️ 跳过",
+	PlanSkipIfSame:   "🔍 比较",
+	PlanConflict:     "⚠️ 冲突",
+	PlanNotEncrypted: "❌ 非加密",
+}
+
+// sniffHeader 只读取魔数头判断是否为 CSEnc 文件
+func sniffHeader(inputFile string) error {
+	file, err := os.Open(inputFile)
+	if err != nil {
+		return fmt.Errorf("failed to open input file: %v", err)
+	}
+	defer file.Close()
+
+	if err := core.NewStreamDecoder(file).ValidateHeader(); err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+	return nil
+}
+
+// pathExists 判断路径是否存在，包括目录和失效的符号链接
+func pathExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
@@ -0,0 +1,198 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/synology-cloud-sync-decrypt-tool/syndecrypt-go/pkg/core"
+)
+
+// DecryptOptions 目录和批量解密的选项
+type DecryptOptions struct {
+	// Jobs 同时解密的文件数，<= 0 时使用 CPU 核数
+	Jobs int
+	// OnConflict 输出文件已存在时的处理方式，为空时报错
+	OnConflict ConflictPolicy
+	// Preserve 从加密文件及其目录复制到输出的属性
+	Preserve Preserve
+	// FailFast 为 true 时第一个文件失败后停止，正在解密的其他文件被取消且不计入结果
+	FailFast bool
+	// Filter 选择目录中要解密的文件
+	Filter Filter
+}
+
+// ErrFailFast 表示 FailFast 时因为有文件失败而提前停止
+var ErrFailFast = errors.New("stopped after first failure")
+
+// jobs 返回实际使用的并发数
+func (o DecryptOptions) jobs() int {
+	if o.Jobs > 0 {
+		return o.Jobs
+	}
+	return runtime.NumCPU()
+}
+
+// decryptTask 一个待解密的文件，index 为提交顺序
+type decryptTask struct {
+	index      int
+	inputFile  string
+	outputFile string
+	// duplicate 表示之前提交的文件已占用同一个输出路径
+	duplicate bool
+}
+
+// decryptOutcome 一个文件的解密结果，skipped 表示因取消而未计入结果
+type decryptOutcome struct {
+	index   int
+	result  DecryptResult
+	skipped bool
+}
+
+// decryptPool 有界的解密工作池。结果按提交顺序记录，
+// 因此统计和失败列表与并发数无关
+type decryptPool struct {
+	// ctx 在调用方取消或 FailFast 停止时结束
+	ctx       context.Context
+	cancel    context.CancelFunc
+	stopped   atomic.Bool
+	config    core.DecryptConfig
+	options   DecryptOptions
+	tasks     chan decryptTask
+	outcomes  chan decryptOutcome
+	workers   sync.WaitGroup
+	collected chan struct{}
+	submitted int
+	// 已提交的输出路径，保证同名输出总是由先提交的文件写入
+	outputs map[string]bool
+}
+
+func newDecryptPool(ctx context.Context, options DecryptOptions, config core.DecryptConfig, results *DecryptResults) *decryptPool {
+	jobs := options.jobs()
+	ctx, cancel := context.WithCancel(ctx)
+	p := &decryptPool{
+		ctx:       ctx,
+		cancel:    cancel,
+		config:    config,
+		options:   options,
+		tasks:     make(chan decryptTask, jobs),
+		outcomes:  make(chan decryptOutcome, jobs),
+		collected: make(chan struct{}),
+		outputs:   make(map[string]bool),
+	}
+
+	for i := 0; i < jobs; i++ {
+		p.workers.Add(1)
+		go p.work()
+	}
+	go p.collect(results)
+
+	return p
+}
+
+// submit 提交一个文件，工作池已满时阻塞
+func (p *decryptPool) submit(inputFile, outputFile string) {
+	task := decryptTask{index: p.submitted, inputFile: inputFile, outputFile: outputFile}
+	// rename 策略下同名输出各自以 O_EXCL 选择新文件名，不算冲突
+	task.duplicate = p.outputs[outputFile] && p.options.OnConflict != ConflictRename
+	p.outputs[outputFile] = true
+
+	p.tasks <- task
+	p.submitted++
+}
+
+// wait 等待所有已提交的文件处理完并记录结果
+func (p *decryptPool) wait() {
+	close(p.tasks)
+	p.workers.Wait()
+	close(p.outcomes)
+	<-p.collected
+	p.cancel()
+}
+
+// failedFast 判断是否因 FailFast 而提前停止
+func (p *decryptPool) failedFast() bool {
+	return p.stopped.Load()
+}
+
+// fail 在 FailFast 时停止处理剩余文件
+func (p *decryptPool) fail() {
+	if p.options.FailFast {
+		p.stopped.Store(true)
+		p.cancel()
+	}
+}
+
+func (p *decryptPool) work() {
+	defer p.workers.Done()
+
+	for task := range p.tasks {
+		// 取消后只消费剩余任务，不再解密
+		if p.ctx.Err() != nil {
+			p.outcomes <- decryptOutcome{index: task.index, skipped: true}
+			continue
+		}
+
+		if task.duplicate {
+			result := duplicateOutputResult(task, p.options.OnConflict)
+			if !result.Success {
+				p.fail()
+			}
+			p.outcomes <- decryptOutcome{index: task.index, result: result}
+			continue
+		}
+
+		result := DecryptFileWithResult(p.ctx, task.inputFile, task.outputFile, p.config, p.options)
+		skipped := p.ctx.Err() != nil
+		if !result.Success && !skipped {
+			p.fail()
+		}
+		p.outcomes <- decryptOutcome{index: task.index, result: result, skipped: skipped}
+	}
+}
+
+// collect 按提交顺序记录结果
+func (p *decryptPool) collect(results *DecryptResults) {
+	defer close(p.collected)
+
+	pending := make(map[int]decryptOutcome)
+	next := 0
+	for outcome := range p.outcomes {
+		pending[outcome.index] = outcome
+		for {
+			ready, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			if !ready.skipped {
+				recordResult(results, ready.result)
+			}
+		}
+	}
+}
+
+// duplicateOutputResult 与先提交的文件输出路径冲突时的结果。skip 策略下跳过，
+// 其他策略报错，不覆盖本次刚写入的文件，也不与它比较
+func duplicateOutputResult(task decryptTask, policy ConflictPolicy) DecryptResult {
+	now := time.Now()
+	result := DecryptResult{
+		InputFile:  task.inputFile,
+		OutputFile: task.outputFile,
+		StartTime:  now,
+		EndTime:    now,
+		Duration:   time.Duration(0).String(),
+	}
+	if policy == ConflictSkip {
+		result.Success = true
+		result.Skipped = true
+	} else {
+		result.SetError(fmt.Errorf("%w: %s", ErrOutputExists, task.outputFile))
+	}
+	return result
+}
@@ -0,0 +1,91 @@
+package files
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/synology-cloud-sync-decrypt-tool/syndecrypt-go/pkg/util"
+)
+
+// Preserve 从加密文件及其目录复制到输出的属性
+type Preserve struct {
+	// Times 访问时间和修改时间
+	Times bool
+	// Mode 权限位（包括 setuid、setgid 和 sticky）
+	Mode bool
+	// Owner uid 和 gid，只在以 root 运行时生效
+	Owner bool
+}
+
+// ParsePreserve 解析逗号分隔的属性列表，例如 "times,mode,owner"
+func ParsePreserve(s string) (Preserve, error) {
+	var preserve Preserve
+	for _, attr := range strings.Split(s, ",") {
+		switch strings.TrimSpace(attr) {
+		case "":
+		case "times":
+			preserve.Times = true
+		case "mode":
+			preserve.Mode = true
+		case "owner":
+			preserve.Owner = true
+		default:
+			return preserve, fmt.Errorf("unknown attribute: %s (want times, mode or owner)", attr)
+		}
+	}
+	return preserve, nil
+}
+
+// any 判断是否需要保留任何属性
+func (p Preserve) any() bool {
+	return p.Times || p.Mode || p.Owner
+}
+
+// preserveAttributes 把源文件 info 的属性应用到 path。
+// 先改所有者再改权限，因为 chown 可能清除 setuid/setgid 位；最后改时间
+func preserveAttributes(path string, info os.FileInfo, preserve Preserve) error {
+	if preserve.Owner && util.CanChown() {
+		if uid, gid, ok := util.FileOwner(info); ok {
+			if err := os.Lchown(path, uid, gid); err != nil {
+				return fmt.Errorf("failed to preserve owner: %v", err)
+			}
+		}
+	}
+
+	if preserve.Mode {
+		mode := info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+		if err := os.Chmod(path, mode); err != nil {
+			return fmt.Errorf("failed to preserve mode: %v", err)
+		}
+	}
+
+	if preserve.Times {
+		if err := os.Chtimes(path, util.FileAccessTime(info), info.ModTime()); err != nil {
+			return fmt.Errorf("failed to preserve times: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// preservedDir 一个需要在解密完成后恢复属性的输出目录
+type preservedDir struct {
+	path string
+	info os.FileInfo
+}
+
+// preserveDirectories 从最深的目录开始恢复属性。必须在目录中的文件都写完之后调用，
+// 否则写入文件会再次修改目录的修改时间。失败时只输出警告
+func preserveDirectories(dirs []preservedDir, preserve Preserve) {
+	for i := len(dirs) - 1; i >= 0; i-- {
+		dir := dirs[i]
+		if _, err := os.Stat(dir.path); err != nil {
+			// 目录中没有解密任何文件时不会创建输出目录
+			continue
+		}
+		if err := preserveAttributes(dir.path, dir.info, preserve); err != nil {
+			fmt.Printf("  ⚠️ 目录 %s - %v\n", dir.path, err)
+		}
+	}
+}
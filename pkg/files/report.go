@@ -0,0 +1,206 @@
+package files
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/synology-cloud-sync-decrypt-tool/syndecrypt-go/pkg/core"
+)
+
+// ReportFormat 解密报告的格式
+type ReportFormat string
+
+const (
+	// ReportText 人类可读的文本报告
+	ReportText ReportFormat = "text"
+	// ReportJSON 包含所有字段的 JSON 报告
+	ReportJSON ReportFormat = "json"
+	// ReportCSV 每个文件一行的 CSV 报告
+	ReportCSV ReportFormat = "csv"
+)
+
+// ParseReportFormat 解析命令行中的报告格式
+func ParseReportFormat(s string) (ReportFormat, error) {
+	switch format := ReportFormat(strings.ToLower(s)); format {
+	case ReportText, ReportJSON, ReportCSV:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown report format: %s (want json, csv or text)", s)
+}
+
+// ErrorClass 返回错误的类别，用于报告和脚本判断
+func ErrorClass(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "canceled"
+	case errors.Is(err, core.ErrWrongPassword):
+		return "wrong_password"
+	case errors.Is(err, core.ErrWrongKey):
+		return "wrong_key"
+	case errors.Is(err, core.ErrKeyMismatch):
+		return "key_mismatch"
+	case errors.Is(err, core.ErrPassphraseRequired), errors.Is(err, core.ErrIncorrectPassphrase):
+		return "passphrase"
+	case errors.Is(err, core.ErrIntegrity):
+		return "integrity"
+	case errors.Is(err, core.ErrUnsupportedVersion):
+		return "unsupported_version"
+	case errors.Is(err, core.ErrCorruptHeader):
+		return "corrupt_header"
+	case errors.Is(err, core.ErrCorruptStream):
+		return "corrupt_stream"
+	case errors.Is(err, core.ErrTruncated):
+		return "truncated"
+	case errors.Is(err, core.ErrDecompression):
+		return "decompression"
+	case errors.Is(err, ErrOutputExists):
+		return "output_exists"
+	}
+	return "other"
+}
+
+// WriteReport 以指定格式写入每个文件的结果和摘要
+func (dr *DecryptResults) WriteReport(w io.Writer, format ReportFormat) error {
+	dr.Finish()
+
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+
+	switch format {
+	case ReportJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(dr)
+	case ReportCSV:
+		return dr.writeCSVReport(w)
+	case ReportText:
+		return dr.writeTextReport(w)
+	}
+	return fmt.Errorf("unknown report format: %s", format)
+}
+
+// SaveReportFile 以指定格式保存报告到 reportFile
+func (dr *DecryptResults) SaveReportFile(reportFile string, format ReportFormat) error {
+	file, err := os.Create(reportFile)
+	if err != nil {
+		return fmt.Errorf("failed to create report file: %v", err)
+	}
+	defer file.Close()
+
+	if err := dr.WriteReport(file, format); err != nil {
+		return fmt.Errorf("failed to write report: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write report: %v", err)
+	}
+
+	fmt.Printf("\n详细报告已保存到: %s\n", reportFile)
+	return nil
+}
+
+// csvReportHeader CSV 报告的列
+var csvReportHeader = []string{
+	"input_file", "output_file", "status", "file_size", "duration",
+	"error_class", "error", "digest_status", "expected_md5", "actual_md5",
+}
+
+func (dr *DecryptResults) writeCSVReport(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write(csvReportHeader)
+	for _, result := range dr.Results {
+		writer.Write([]string{
+			result.InputFile,
+			result.OutputFile,
+			result.status(),
+			strconv.FormatInt(result.FileSize, 10),
+			result.Duration,
+			result.ErrorClass,
+			result.Error,
+			result.DigestStatus,
+			result.ExpectedMD5,
+			result.ActualMD5,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// status 返回 success、skipped 或 failed
+func (r DecryptResult) status() string {
+	switch {
+	case r.Skipped:
+		return "skipped"
+	case r.Success:
+		return "success"
+	}
+	return "failed"
+}
+
+func (dr *DecryptResults) writeTextReport(w io.Writer) error {
+	// 写入报告标题
+	fmt.Fprintf(w, "Synology Cloud Sync 解密报告\n")
+	fmt.Fprintf(w, "生成时间: %s\n", time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(w, "%s\n\n", strings.Repeat("=", 60))
+
+	// 写入摘要
+	fmt.Fprintf(w, "摘要统计:\n")
+	fmt.Fprintf(w, "  总文件数: %d\n", dr.TotalFiles)
+	fmt.Fprintf(w, "  成功: %d\n", dr.SuccessCount)
+	fmt.Fprintf(w, "  失败: %d\n", dr.FailedCount)
+	fmt.Fprintf(w, "  跳过: %d\n", dr.SkippedCount)
+	fmt.Fprintf(w, "  总耗时: %s\n\n", dr.TotalDuration)
+
+	// 写入失败文件
+	if dr.FailedCount > 0 {
+		fmt.Fprintf(w, "失败文件:\n")
+		for _, result := range dr.Results {
+			if !result.Success {
+				fmt.Fprintf(w, "  ❌ %s\n", result.InputFile)
+				fmt.Fprintf(w, "     错误: %s\n", result.Error)
+				fmt.Fprintf(w, "     类别: %s\n", result.ErrorClass)
+				if result.IntegrityError() {
+					fmt.Fprintf(w, "     期望 MD5: %s\n", result.ExpectedMD5)
+					fmt.Fprintf(w, "     实际 MD5: %s\n", result.ActualMD5)
+				}
+				fmt.Fprintf(w, "     时间: %s\n\n", result.Duration)
+			}
+		}
+	}
+
+	// 写入成功文件
+	if dr.SuccessCount > 0 {
+		fmt.Fprintf(w, "成功文件:\n")
+		for _, result := range dr.Results {
+			if result.Success && !result.Skipped {
+				fmt.Fprintf(w, "  ✅ %s\n", result.InputFile)
+				fmt.Fprintf(w, "     输出: %s\n", result.OutputFile)
+				fmt.Fprintf(w, "     大小: %d 字节\n", result.FileSize)
+				fmt.Fprintf(w, "     校验: %s\n", result.DigestStatus)
+				fmt.Fprintf(w, "     时间: %s\n\n", result.Duration)
+			}
+		}
+	}
+
+	// 写入跳过的文件
+	if dr.SkippedCount > 0 {
+		fmt.Fprintf(w, "跳过文件:\n")
+		for _, result := range dr.Results {
+			if result.Skipped {
+				fmt.Fprintf(w, "  ⏭️ %s\n", result.InputFile)
+				fmt.Fprintf(w, "     已有输出: %s\n\n", result.OutputFile)
+			}
+		}
+	}
+
+	return nil
+}
@@ -1,12 +1,14 @@
 package files
 
 import (
+	"errors"
 	"fmt"
-	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/synology-cloud-sync-decrypt-tool/syndecrypt-go/pkg/core"
 )
 
 // DecryptResult 记录单个文件的解密结果
@@ -23,6 +25,69 @@ type DecryptResult struct {
 	FileCount    int       `json:"file_count,omitempty"`
 	SuccessCount int       `json:"success_count,omitempty"`
 	FailedCount  int       `json:"failed_count,omitempty"`
+	SkippedCount int       `json:"skipped_count,omitempty"`
+	// file_md5 校验信息
+	ExpectedMD5 string `json:"expected_md5,omitempty"`
+	ActualMD5   string `json:"actual_md5,omitempty"`
+	// DigestStatus file_md5 校验状态，见 DigestStatusVerified 等常量
+	DigestStatus string `json:"digest_status,omitempty"`
+	// ErrorClass 错误类别，见 ErrorClass
+	ErrorClass string `json:"error_class,omitempty"`
+	// Skipped 为 true 时输出已存在，按冲突策略跳过（Success 同时为 true）
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// file_md5 校验状态
+const (
+	// DigestStatusVerified 解密结果与 file_md5 一致
+	DigestStatusVerified = "verified"
+	// DigestStatusMismatch 解密结果与 file_md5 不一致
+	DigestStatusMismatch = "mismatch"
+	// DigestStatusMissing 文件没有记录 file_md5
+	DigestStatusMissing = "missing"
+	// DigestStatusUnverified 使用 --no-verify 跳过了校验
+	DigestStatusUnverified = "unverified"
+)
+
+// SetDigest 记录 file_md5 校验结果
+func (r *DecryptResult) SetDigest(digest core.DigestResult, err error) {
+	r.ExpectedMD5 = digest.Expected
+	r.ActualMD5 = digest.Actual
+
+	var mismatch *core.DigestMismatchError
+	if errors.As(err, &mismatch) {
+		r.ExpectedMD5 = mismatch.Expected
+		r.ActualMD5 = mismatch.Actual
+	}
+
+	switch {
+	case mismatch != nil:
+		r.DigestStatus = DigestStatusMismatch
+	case digest.Verified:
+		r.DigestStatus = DigestStatusVerified
+	case err != nil:
+		// 解密没有完成，无法判断
+	case digest.Expected == "":
+		r.DigestStatus = DigestStatusMissing
+	default:
+		r.DigestStatus = DigestStatusUnverified
+	}
+}
+
+// DigestVerified 判断解密结果是否与 file_md5 一致
+func (r DecryptResult) DigestVerified() bool {
+	return r.DigestStatus == DigestStatusVerified
+}
+
+// IntegrityError 判断解密结果是否未通过 file_md5 校验
+func (r DecryptResult) IntegrityError() bool {
+	return r.DigestStatus == DigestStatusMismatch
+}
+
+// SetError 记录错误信息及其类别
+func (r *DecryptResult) SetError(err error) {
+	r.Error = err.Error()
+	r.ErrorClass = ErrorClass(err)
 }
 
 // DecryptResults 记录批量解密的结果
@@ -32,6 +97,7 @@ type DecryptResults struct {
 	TotalFiles    int             `json:"total_files"`
 	SuccessCount  int             `json:"success_count"`
 	FailedCount   int             `json:"failed_count"`
+	SkippedCount  int             `json:"skipped_count"`
 	StartTime     time.Time       `json:"start_time"`
 	EndTime       time.Time       `json:"end_time"`
 	TotalDuration string          `json:"total_duration"`
@@ -51,7 +117,9 @@ func (dr *DecryptResults) AddResult(result DecryptResult) {
 	defer dr.mu.Unlock()
 
 	dr.Results = append(dr.Results, result)
-	if result.Success {
+	if result.Skipped {
+		dr.SkippedCount++
+	} else if result.Success {
 		dr.SuccessCount++
 	} else {
 		dr.FailedCount++
@@ -59,6 +127,17 @@ func (dr *DecryptResults) AddResult(result DecryptResult) {
 	dr.TotalFiles++
 }
 
+// Merge 追加另一组结果，例如目录解密的逐个文件结果
+func (dr *DecryptResults) Merge(other *DecryptResults) {
+	other.mu.Lock()
+	merged := append([]DecryptResult(nil), other.Results...)
+	other.mu.Unlock()
+
+	for _, result := range merged {
+		dr.AddResult(result)
+	}
+}
+
 // Finish 完成结果记录
 func (dr *DecryptResults) Finish() {
 	dr.mu.Lock()
@@ -81,6 +160,9 @@ func (dr *DecryptResults) PrintSummary() {
 	fmt.Printf("总文件数: %d\n", dr.TotalFiles)
 	fmt.Printf("成功: %d\n", dr.SuccessCount)
 	fmt.Printf("失败: %d\n", dr.FailedCount)
+	if dr.SkippedCount > 0 {
+		fmt.Printf("跳过: %d\n", dr.SkippedCount)
+	}
 	fmt.Printf("总耗时: %s\n", dr.TotalDuration)
 	fmt.Println(strings.Repeat("=", 60))
 
@@ -97,56 +179,9 @@ func (dr *DecryptResults) PrintSummary() {
 }
 
 
-// SaveReport 保存详细报告到文件
+// SaveReport 保存文本格式的详细报告到 outputDir/decryption_report.txt
 func (dr *DecryptResults) SaveReport(outputDir string) error {
-	dr.Finish()
-
-	reportFile := filepath.Join(outputDir, "decryption_report.txt")
-	file, err := os.Create(reportFile)
-	if err != nil {
-		return fmt.Errorf("failed to create report file: %v", err)
-	}
-	defer file.Close()
-
-	// 写入报告标题
-	fmt.Fprintf(file, "Synology Cloud Sync 解密报告\n")
-	fmt.Fprintf(file, "生成时间: %s\n", time.Now().Format("2006-01-02 15:04:05"))
-	fmt.Fprintf(file, "%s\n\n", strings.Repeat("=", 60))
-
-	// 写入摘要
-	fmt.Fprintf(file, "摘要统计:\n")
-	fmt.Fprintf(file, "  总文件数: %d\n", dr.TotalFiles)
-	fmt.Fprintf(file, "  成功: %d\n", dr.SuccessCount)
-	fmt.Fprintf(file, "  失败: %d\n", dr.FailedCount)
-	fmt.Fprintf(file, "  总耗时: %s\n\n", dr.TotalDuration)
-
-	// 写入失败文件
-	if dr.FailedCount > 0 {
-		fmt.Fprintf(file, "失败文件:\n")
-		for _, result := range dr.Results {
-			if !result.Success {
-				fmt.Fprintf(file, "  ❌ %s\n", result.InputFile)
-				fmt.Fprintf(file, "     错误: %s\n", result.Error)
-				fmt.Fprintf(file, "     时间: %s\n\n", result.Duration)
-			}
-		}
-	}
-
-	// 写入成功文件
-	if dr.SuccessCount > 0 {
-		fmt.Fprintf(file, "成功文件:\n")
-		for _, result := range dr.Results {
-			if result.Success {
-				fmt.Fprintf(file, "  ✅ %s\n", result.InputFile)
-				fmt.Fprintf(file, "     输出: %s\n", result.OutputFile)
-				fmt.Fprintf(file, "     大小: %d 字节\n", result.FileSize)
-				fmt.Fprintf(file, "     时间: %s\n\n", result.Duration)
-			}
-		}
-	}
-
-	fmt.Printf("\n详细报告已保存到: %s\n", reportFile)
-	return nil
+	return dr.SaveReportFile(filepath.Join(outputDir, "decryption_report.txt"), ReportText)
 }
 
 // PrintProgress 打印进度信息
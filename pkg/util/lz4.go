@@ -1,20 +1,69 @@
 package util
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
-	"io"
-	"os/exec"
-	"sync"
 )
 
+const (
+	lz4FrameMagic        uint32 = 0x184D2204
+	lz4LegacyMagic       uint32 = 0x184C2102
+	lz4SkippableMagicMin uint32 = 0x184D2A50
+	lz4SkippableMagicMax uint32 = 0x184D2A5F
+
+	lz4LegacyBlockSize = 8 << 20 // 旧格式每块最多 8MB
+	lz4WindowSize      = 64 << 10
+)
+
+// 解码器状态
+const (
+	lz4StateMagic = iota
+	lz4StateDescriptor
+	lz4StateBlockSize
+	lz4StateBlockData
+	lz4StateContentChecksum
+	lz4StateSkippableSize
+	lz4StateSkip
+	lz4StateLegacyBlock
+)
+
+// ErrLz4Corrupt 表示 LZ4 数据损坏
+var ErrLz4Corrupt = errors.New("corrupt lz4 data")
+
+// ErrLz4Truncated 表示 LZ4 帧在结束前被截断
+var ErrLz4Truncated = errors.New("unexpected end of lz4 stream")
+
+// Lz4Decompressor 进程内 LZ4 帧解压器，支持块校验、内容校验以及链接/独立块
 type Lz4Decompressor struct {
-	cmd       *exec.Cmd
-	stdin     io.WriteCloser
-	stdout    io.ReadCloser
-	handler   func([]byte)
-	filename  string
-	mu        sync.Mutex
-	isClosed  bool
+	handler  func([]byte)
+	filename string
+	err      error
+	isClosed bool
+
+	state   int
+	pending []byte
+	// pending 中已消费的字节数
+	offset int
+	// 当前帧参数
+	blockIndependent bool
+	blockChecksum    bool
+	contentChecksum  bool
+	hasContentSize   bool
+	contentSize      uint64
+	maxBlockSize     int
+	// 当前块
+	blockSize         int
+	blockUncompressed bool
+	// 帧内已输出的数据量与内容校验
+	produced    uint64
+	contentHash *XXH32
+	// 链接块模式下保留的历史窗口
+	window []byte
+	// 可跳过帧剩余字节
+	skipRemaining uint32
+	// 是否在旧格式帧中
+	legacy bool
 }
 
 func NewLz4Decompressor(decompressedChunkHandler func([]byte)) (*Lz4Decompressor, error) {
@@ -22,93 +71,425 @@ func NewLz4Decompressor(decompressedChunkHandler func([]byte)) (*Lz4Decompressor
 }
 
 func NewLz4DecompressorWithFilename(decompressedChunkHandler func([]byte), filename string) (*Lz4Decompressor, error) {
-	cmd := exec.Command("lz4", "-d")
+	if decompressedChunkHandler == nil {
+		return nil, errors.New("decompressed chunk handler is nil")
+	}
+
+	return &Lz4Decompressor{
+		handler:     decompressedChunkHandler,
+		filename:    filename,
+		state:       lz4StateMagic,
+		contentHash: NewXXH32(0),
+	}, nil
+}
 
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create stdin pipe: %v", err)
+// Write 输入压缩数据，每解出一个完整块就调用一次处理函数
+func (l *Lz4Decompressor) Write(data []byte) error {
+	if l.err != nil {
+		return l.err
+	}
+	if l.isClosed {
+		return errors.New("lz4 decompressor already closed")
 	}
 
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		stdin.Close()
-		return nil, fmt.Errorf("failed to create stdout pipe: %v", err)
+	// 已消费部分超过剩余数据时将剩余数据移到开头，复用缓冲区空间
+	if l.offset > 0 && l.offset >= len(l.pending)-l.offset {
+		n := copy(l.pending, l.pending[l.offset:])
+		l.pending = l.pending[:n]
+		l.offset = 0
 	}
+	l.pending = append(l.pending, data...)
 
-	if err := cmd.Start(); err != nil {
-		stdin.Close()
-		stdout.Close()
-		return nil, fmt.Errorf("failed to start lz4: %v", err)
+	if err := l.process(); err != nil {
+		l.err = l.wrapError(err)
+		return l.err
 	}
+	return nil
+}
 
-	decomp := &Lz4Decompressor{
-		cmd:      cmd,
-		stdin:    stdin,
-		stdout:   stdout,
-		handler:  decompressedChunkHandler,
-		filename: filename,
+// Close 结束输入并检查帧是否完整
+func (l *Lz4Decompressor) Close() error {
+	if l.isClosed {
+		return l.err
+	}
+	l.isClosed = true
+
+	if l.err != nil {
+		return l.err
 	}
 
-	// 启动 goroutine 读取解压后的数据
-	go decomp.readOutput()
+	complete := len(l.buffered()) == 0 &&
+		(l.state == lz4StateMagic || (l.legacy && l.state == lz4StateBlockSize))
+	if !complete {
+		l.err = l.wrapError(ErrLz4Truncated)
+	}
+	return l.err
+}
 
-	return decomp, nil
+func (l *Lz4Decompressor) wrapError(err error) error {
+	if l.filename != "" {
+		return fmt.Errorf("lz4 decompression failed for %s: %w", l.filename, err)
+	}
+	return fmt.Errorf("lz4 decompression failed: %w", err)
 }
 
-func (l *Lz4Decompressor) readOutput() {
-	buffer := make([]byte, 64*1024) // 64KB buffer
+// process 尽可能多地消费缓冲区中的数据
+func (l *Lz4Decompressor) process() error {
 	for {
-		n, err := l.stdout.Read(buffer)
-		if err != nil {
-			if err != io.EOF {
-				// 检查是否是关闭时的正常错误，避免误报
-				l.mu.Lock()
-				isClosed := l.isClosed
-				l.mu.Unlock()
-
-				// 只有在非关闭状态下才报告错误，避免竞争条件的误报
-				if !isClosed {
-					if l.filename != "" {
-						fmt.Printf("❌ 文件 %s - lz4解压错误: %v\n", l.filename, err)
-					} else {
-						fmt.Printf("❌ lz4解压错误: %v\n", err)
-					}
+		pending := l.buffered()
+		switch l.state {
+		case lz4StateMagic:
+			if len(pending) < 4 {
+				return nil
+			}
+			if err := l.startFrame(binary.LittleEndian.Uint32(pending)); err != nil {
+				return err
+			}
+			l.consume(4)
+
+		case lz4StateDescriptor:
+			if len(pending) < 2 {
+				return nil
+			}
+			need := 3
+			flg := pending[0]
+			if flg&0x08 != 0 {
+				need += 8
+			}
+			if flg&0x01 != 0 {
+				need += 4
+			}
+			if len(pending) < need {
+				return nil
+			}
+			if err := l.parseDescriptor(pending[:need]); err != nil {
+				return err
+			}
+			l.consume(need)
+			l.state = lz4StateBlockSize
+
+		case lz4StateBlockSize:
+			if len(pending) < 4 {
+				return nil
+			}
+			value := binary.LittleEndian.Uint32(pending)
+			if l.legacy {
+				// 旧格式没有结束标记，遇到新的魔数即视为下一帧
+				if isLz4Magic(value) {
+					l.legacy = false
+					l.state = lz4StateMagic
+					continue
 				}
+				if value > uint32(lz4CompressBound(lz4LegacyBlockSize)) {
+					return fmt.Errorf("%w: legacy block size %d too large", ErrLz4Corrupt, value)
+				}
+				l.consume(4)
+				l.blockSize = int(value)
+				l.state = lz4StateLegacyBlock
+				continue
 			}
-			return
-		}
-		if n > 0 {
-			l.handler(buffer[:n])
+			l.consume(4)
+			if value == 0 {
+				if err := l.endFrame(); err != nil {
+					return err
+				}
+				continue
+			}
+			l.blockUncompressed = value&0x80000000 != 0
+			l.blockSize = int(value & 0x7FFFFFFF)
+			if l.blockSize > l.maxBlockSize {
+				return fmt.Errorf("%w: block size %d exceeds maximum %d", ErrLz4Corrupt, l.blockSize, l.maxBlockSize)
+			}
+			l.state = lz4StateBlockData
+
+		case lz4StateBlockData:
+			need := l.blockSize
+			if l.blockChecksum {
+				need += 4
+			}
+			if len(pending) < need {
+				return nil
+			}
+			block := pending[:l.blockSize]
+			if l.blockChecksum {
+				expected := binary.LittleEndian.Uint32(pending[l.blockSize:])
+				if actual := XXH32Sum(block, 0); actual != expected {
+					return fmt.Errorf("%w: block checksum mismatch", ErrLz4Corrupt)
+				}
+			}
+			if err := l.decodeBlock(block, l.blockUncompressed, l.maxBlockSize, l.blockIndependent); err != nil {
+				return err
+			}
+			l.consume(need)
+			l.state = lz4StateBlockSize
+
+		case lz4StateContentChecksum:
+			if len(pending) < 4 {
+				return nil
+			}
+			expected := binary.LittleEndian.Uint32(pending)
+			if actual := l.contentHash.Sum32(); actual != expected {
+				return fmt.Errorf("%w: content checksum mismatch", ErrLz4Corrupt)
+			}
+			l.consume(4)
+			l.state = lz4StateMagic
+
+		case lz4StateSkippableSize:
+			if len(pending) < 4 {
+				return nil
+			}
+			l.skipRemaining = binary.LittleEndian.Uint32(pending)
+			l.consume(4)
+			l.state = lz4StateSkip
+
+		case lz4StateSkip:
+			n := len(pending)
+			if uint32(n) > l.skipRemaining {
+				n = int(l.skipRemaining)
+			}
+			l.consume(n)
+			l.skipRemaining -= uint32(n)
+			if l.skipRemaining > 0 {
+				return nil
+			}
+			l.state = lz4StateMagic
+
+		case lz4StateLegacyBlock:
+			if len(pending) < l.blockSize {
+				return nil
+			}
+			if err := l.decodeBlock(pending[:l.blockSize], false, lz4LegacyBlockSize, true); err != nil {
+				return err
+			}
+			l.consume(l.blockSize)
+			l.state = lz4StateBlockSize
+
+		default:
+			return fmt.Errorf("invalid decoder state %d", l.state)
 		}
 	}
 }
 
-func (l *Lz4Decompressor) Write(data []byte) error {
-	_, err := l.stdin.Write(data)
-	return err
+// buffered 返回尚未消费的输入
+func (l *Lz4Decompressor) buffered() []byte {
+	return l.pending[l.offset:]
 }
 
-func (l *Lz4Decompressor) Close() error {
-	// 设置关闭状态，避免竞争条件的误报
-	l.mu.Lock()
-	l.isClosed = true
-	l.mu.Unlock()
+func (l *Lz4Decompressor) consume(n int) {
+	l.offset += n
+}
 
-	// 关闭输入管道
-	if err := l.stdin.Close(); err != nil {
-		return fmt.Errorf("failed to close stdin: %v", err)
+// startFrame 根据魔数进入对应的帧类型
+func (l *Lz4Decompressor) startFrame(magic uint32) error {
+	switch {
+	case magic == lz4FrameMagic:
+		l.state = lz4StateDescriptor
+	case magic == lz4LegacyMagic:
+		l.legacy = true
+		l.window = l.window[:0]
+		l.state = lz4StateBlockSize
+	case magic >= lz4SkippableMagicMin && magic <= lz4SkippableMagicMax:
+		l.state = lz4StateSkippableSize
+	default:
+		return fmt.Errorf("%w: unknown frame magic 0x%08X", ErrLz4Corrupt, magic)
 	}
+	return nil
+}
 
-	// 等待命令完成
-	if err := l.cmd.Wait(); err != nil {
-		return fmt.Errorf("lz4 command failed: %v", err)
+// parseDescriptor 解析并校验帧描述符 (FLG, BD, 可选内容大小和字典 ID, HC)
+func (l *Lz4Decompressor) parseDescriptor(desc []byte) error {
+	flg, bd := desc[0], desc[1]
+
+	if flg>>6 != 0x01 {
+		return fmt.Errorf("%w: unsupported frame version %d", ErrLz4Corrupt, flg>>6)
+	}
+	if flg&0x02 != 0 || bd&0x8F != 0 {
+		return fmt.Errorf("%w: reserved descriptor bits set", ErrLz4Corrupt)
+	}
+
+	switch (bd >> 4) & 0x07 {
+	case 4:
+		l.maxBlockSize = 64 << 10
+	case 5:
+		l.maxBlockSize = 256 << 10
+	case 6:
+		l.maxBlockSize = 1 << 20
+	case 7:
+		l.maxBlockSize = 4 << 20
+	default:
+		return fmt.Errorf("%w: invalid block maximum size %d", ErrLz4Corrupt, (bd>>4)&0x07)
+	}
+
+	expected := desc[len(desc)-1]
+	if actual := byte(XXH32Sum(desc[:len(desc)-1], 0) >> 8); actual != expected {
+		return fmt.Errorf("%w: header checksum mismatch", ErrLz4Corrupt)
+	}
+
+	if flg&0x01 != 0 {
+		return errors.New("lz4 frames with a dictionary ID are not supported")
 	}
 
+	l.blockIndependent = flg&0x20 != 0
+	l.blockChecksum = flg&0x10 != 0
+	l.hasContentSize = flg&0x08 != 0
+	l.contentChecksum = flg&0x04 != 0
+	if l.hasContentSize {
+		l.contentSize = binary.LittleEndian.Uint64(desc[2:])
+	}
+
+	l.produced = 0
+	l.contentHash.Reset(0)
+	l.window = l.window[:0]
+	return nil
+}
+
+// endFrame 处理结束标记
+func (l *Lz4Decompressor) endFrame() error {
+	if l.hasContentSize && l.produced != l.contentSize {
+		return fmt.Errorf("%w: content size mismatch: expected %d, got %d", ErrLz4Corrupt, l.contentSize, l.produced)
+	}
+	if l.contentChecksum {
+		l.state = lz4StateContentChecksum
+	} else {
+		l.state = lz4StateMagic
+	}
 	return nil
 }
 
+// decodeBlock 解压一个块并交给处理函数
+func (l *Lz4Decompressor) decodeBlock(block []byte, uncompressed bool, maxSize int, independent bool) error {
+	if independent {
+		l.window = l.window[:0]
+	}
+
+	start := len(l.window)
+	var err error
+	if uncompressed {
+		if len(block) > maxSize {
+			return fmt.Errorf("%w: uncompressed block too large", ErrLz4Corrupt)
+		}
+		l.window = append(l.window, block...)
+	} else {
+		l.window, err = lz4DecodeBlock(l.window, block, maxSize)
+		if err != nil {
+			return err
+		}
+	}
+
+	out := l.window[start:]
+	l.produced += uint64(len(out))
+	if l.contentChecksum {
+		l.contentHash.Write(out)
+	}
+	if len(out) > 0 {
+		// 处理函数可能保留数据，交出副本
+		chunk := make([]byte, len(out))
+		copy(chunk, out)
+		l.handler(chunk)
+	}
+
+	// 链接块只需要最后 64KB 作为历史
+	if independent {
+		l.window = l.window[:0]
+	} else if len(l.window) > lz4WindowSize {
+		l.window = append(l.window[:0], l.window[len(l.window)-lz4WindowSize:]...)
+	}
+	return nil
+}
+
+// lz4DecodeBlock 将一个 LZ4 块解压并追加到 dst，dst 中已有的数据作为匹配字典
+func lz4DecodeBlock(dst, src []byte, maxSize int) ([]byte, error) {
+	start := len(dst)
+	i := 0
+
+	for {
+		if i >= len(src) {
+			return nil, fmt.Errorf("%w: unexpected end of block", ErrLz4Corrupt)
+		}
+		token := src[i]
+		i++
+
+		// 字面量
+		litLen := int(token >> 4)
+		if litLen == 15 {
+			for {
+				if i >= len(src) {
+					return nil, fmt.Errorf("%w: truncated literal length", ErrLz4Corrupt)
+				}
+				b := src[i]
+				i++
+				litLen += int(b)
+				if b != 255 {
+					break
+				}
+			}
+		}
+		if litLen > len(src)-i {
+			return nil, fmt.Errorf("%w: literal run exceeds block", ErrLz4Corrupt)
+		}
+		if len(dst)-start+litLen > maxSize {
+			return nil, fmt.Errorf("%w: block output exceeds %d bytes", ErrLz4Corrupt, maxSize)
+		}
+		dst = append(dst, src[i:i+litLen]...)
+		i += litLen
+
+		// 最后一个序列只有字面量
+		if i == len(src) {
+			return dst, nil
+		}
+
+		// 匹配
+		if len(src)-i < 2 {
+			return nil, fmt.Errorf("%w: truncated match offset", ErrLz4Corrupt)
+		}
+		offset := int(binary.LittleEndian.Uint16(src[i:]))
+		i += 2
+		if offset == 0 || offset > len(dst) {
+			return nil, fmt.Errorf("%w: invalid match offset %d", ErrLz4Corrupt, offset)
+		}
+
+		matchLen := int(token&0x0F) + 4
+		if token&0x0F == 15 {
+			for {
+				if i >= len(src) {
+					return nil, fmt.Errorf("%w: truncated match length", ErrLz4Corrupt)
+				}
+				b := src[i]
+				i++
+				matchLen += int(b)
+				if b != 255 {
+					break
+				}
+			}
+		}
+		if len(dst)-start+matchLen > maxSize {
+			return nil, fmt.Errorf("%w: block output exceeds %d bytes", ErrLz4Corrupt, maxSize)
+		}
+
+		pos := len(dst) - offset
+		if offset >= matchLen {
+			dst = append(dst, dst[pos:pos+matchLen]...)
+		} else {
+			// 重叠匹配需要逐字节复制
+			for k := 0; k < matchLen; k++ {
+				dst = append(dst, dst[pos+k])
+			}
+		}
+	}
+}
+
+func isLz4Magic(value uint32) bool {
+	return value == lz4FrameMagic || value == lz4LegacyMagic ||
+		(value >= lz4SkippableMagicMin && value <= lz4SkippableMagicMax)
+}
+
+// lz4CompressBound 返回压缩指定大小数据可能得到的最大长度
+func lz4CompressBound(size int) int {
+	return size + size/255 + 16
+}
+
 // Base64Decode 解码 base64 字符串
 func Base64Decode(data string) ([]byte, error) {
 	// 实现 base64 解码
 	return nil, fmt.Errorf("not implemented")
-}
\ No newline at end of file
+}
@@ -0,0 +1,206 @@
+package util
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	lz4CompressBlockSize = 64 << 10 // 与 BD=4 对应的最大块大小
+	lz4MinMatch          = 4
+	lz4MFLimit           = 12 // 最后一个匹配必须在块结束前 12 字节之前开始
+	lz4LastLiterals      = 5  // 块最后 5 字节必须是字面量
+	lz4MaxOffset         = 65535
+	lz4HashLog           = 16
+)
+
+// Lz4Compressor 生成 LZ4 帧格式数据（独立块 + 内容校验），可被 Lz4Decompressor 和 lz4 -d 解压
+type Lz4Compressor struct {
+	writer      io.Writer
+	buffer      []byte
+	table       []int32
+	contentHash *XXH32
+	wroteHeader bool
+	isClosed    bool
+}
+
+// NewLz4Compressor 创建写入 writer 的 LZ4 帧压缩器
+func NewLz4Compressor(writer io.Writer) *Lz4Compressor {
+	return &Lz4Compressor{
+		writer:      writer,
+		buffer:      make([]byte, 0, lz4CompressBlockSize),
+		table:       make([]int32, 1<<lz4HashLog),
+		contentHash: NewXXH32(0),
+	}
+}
+
+// Write 写入未压缩数据，每满一个块就压缩输出
+func (c *Lz4Compressor) Write(data []byte) (int, error) {
+	if c.isClosed {
+		return 0, errors.New("lz4 compressor already closed")
+	}
+
+	n := len(data)
+	for len(data) > 0 {
+		space := lz4CompressBlockSize - len(c.buffer)
+		if space > len(data) {
+			space = len(data)
+		}
+		c.buffer = append(c.buffer, data[:space]...)
+		data = data[space:]
+
+		if len(c.buffer) == lz4CompressBlockSize {
+			if err := c.flushBlock(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close 输出剩余数据、结束标记和内容校验
+func (c *Lz4Compressor) Close() error {
+	if c.isClosed {
+		return nil
+	}
+	c.isClosed = true
+
+	if len(c.buffer) > 0 {
+		if err := c.flushBlock(); err != nil {
+			return err
+		}
+	}
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+
+	trailer := make([]byte, 8)
+	binary.LittleEndian.PutUint32(trailer[4:], c.contentHash.Sum32())
+	_, err := c.writer.Write(trailer)
+	return err
+}
+
+func (c *Lz4Compressor) writeHeader() error {
+	if c.wroteHeader {
+		return nil
+	}
+	c.wroteHeader = true
+
+	// FLG: 版本 01、独立块、内容校验；BD: 最大块 64KB
+	header := make([]byte, 7)
+	binary.LittleEndian.PutUint32(header, lz4FrameMagic)
+	header[4] = 0x40 | 0x20 | 0x04
+	header[5] = 4 << 4
+	header[6] = byte(XXH32Sum(header[4:6], 0) >> 8)
+	_, err := c.writer.Write(header)
+	return err
+}
+
+// flushBlock 压缩缓冲区中的一个块，压缩无收益时按原样存储
+func (c *Lz4Compressor) flushBlock() error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+
+	block := c.buffer
+	c.contentHash.Write(block)
+
+	compressed := lz4CompressBlock(block, c.table)
+	size := make([]byte, 4)
+	if len(compressed) < len(block) {
+		binary.LittleEndian.PutUint32(size, uint32(len(compressed)))
+	} else {
+		binary.LittleEndian.PutUint32(size, uint32(len(block))|0x80000000)
+		compressed = block
+	}
+
+	if _, err := c.writer.Write(size); err != nil {
+		return err
+	}
+	if _, err := c.writer.Write(compressed); err != nil {
+		return err
+	}
+
+	c.buffer = c.buffer[:0]
+	return nil
+}
+
+// lz4CompressBlock 使用单哈希表贪心匹配压缩一个独立块
+func lz4CompressBlock(src []byte, table []int32) []byte {
+	dst := make([]byte, 0, lz4CompressBound(len(src)))
+	if len(src) <= lz4MFLimit {
+		return lz4AppendSequence(dst, src, 0, 0)
+	}
+
+	for i := range table {
+		table[i] = -1
+	}
+
+	anchor := 0
+	limit := len(src) - lz4MFLimit
+	for i := 0; i < limit; {
+		seq := binary.LittleEndian.Uint32(src[i:])
+		h := (seq * 2654435761) >> (32 - lz4HashLog)
+		ref := int(table[h])
+		table[h] = int32(i)
+
+		if ref < 0 || i-ref > lz4MaxOffset || binary.LittleEndian.Uint32(src[ref:]) != seq {
+			i++
+			continue
+		}
+
+		// 向后扩展匹配，保证最后 5 字节为字面量
+		matchLen := lz4MinMatch
+		for i+matchLen < len(src)-lz4LastLiterals && src[ref+matchLen] == src[i+matchLen] {
+			matchLen++
+		}
+
+		dst = lz4AppendSequence(dst, src[anchor:i], i-ref, matchLen)
+		i += matchLen
+		anchor = i
+	}
+
+	return lz4AppendSequence(dst, src[anchor:], 0, 0)
+}
+
+// lz4AppendSequence 追加一个序列；matchLen 为 0 表示只有字面量的最后一个序列
+func lz4AppendSequence(dst, literals []byte, offset, matchLen int) []byte {
+	litLen := len(literals)
+
+	token := byte(0)
+	if litLen >= 15 {
+		token = 15 << 4
+	} else {
+		token = byte(litLen) << 4
+	}
+	if matchLen > 0 {
+		if matchLen-lz4MinMatch >= 15 {
+			token |= 15
+		} else {
+			token |= byte(matchLen - lz4MinMatch)
+		}
+	}
+
+	dst = append(dst, token)
+	if litLen >= 15 {
+		dst = lz4AppendLength(dst, litLen-15)
+	}
+	dst = append(dst, literals...)
+
+	if matchLen > 0 {
+		dst = append(dst, byte(offset), byte(offset>>8))
+		if matchLen-lz4MinMatch >= 15 {
+			dst = lz4AppendLength(dst, matchLen-lz4MinMatch-15)
+		}
+	}
+	return dst
+}
+
+func lz4AppendLength(dst []byte, n int) []byte {
+	for n >= 255 {
+		dst = append(dst, 255)
+		n -= 255
+	}
+	return append(dst, byte(n))
+}
@@ -0,0 +1,235 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const lz4TestText = "Synology Cloud Sync Synology Cloud Sync Synology Cloud Sync!\n"
+
+// 由 `lz4 -BX --content-size` 生成：带块校验、内容校验和内容大小
+var lz4TestFrame = []byte{
+	0x04, 0x22, 0x4d, 0x18, 0x7c, 0x40, 0x3d, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0xe1, 0x21, 0x00, 0x00, 0x00, 0xf0, 0x04, 0x53, 0x79, 0x6e,
+	0x6f, 0x6c, 0x6f, 0x67, 0x79, 0x20, 0x43, 0x6c, 0x6f, 0x75, 0x64, 0x20,
+	0x53, 0x79, 0x6e, 0x63, 0x05, 0x00, 0x0f, 0x14, 0x00, 0x0e, 0x50, 0x79,
+	0x6e, 0x63, 0x21, 0x0a, 0xcf, 0x6c, 0x33, 0xba, 0x00, 0x00, 0x00, 0x00,
+	0xe5, 0x72, 0x8b, 0xd6,
+}
+
+// 由 `lz4 -B4 -BD -BX` 压缩 lz4TestText 重复 1200 次生成：64 KB 的关联块，
+// 第二个块开头的匹配引用第一个块中的数据
+var lz4TestLinkedFrame = []byte{
+	0x04, 0x22, 0x4d, 0x18, 0x54, 0x40, 0xae, 0x2d, 0x01, 0x00, 0x00, 0xff,
+	0x05, 0x53, 0x79, 0x6e, 0x6f, 0x6c, 0x6f, 0x67, 0x79, 0x20, 0x43, 0x6c,
+	0x6f, 0x75, 0x64, 0x20, 0x53, 0x79, 0x6e, 0x63, 0x20, 0x14, 0x00, 0x14,
+	0x2f, 0x21, 0x0a, 0x29, 0x00, 0x14, 0x0f, 0x51, 0x00, 0x01, 0x0f, 0x3d,
+	0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0x70, 0x50, 0x6e, 0x63, 0x20, 0x53, 0x79,
+	0x13, 0x8f, 0x6c, 0x68, 0x2b, 0x00, 0x00, 0x00, 0x0f, 0xfe, 0xff, 0x12,
+	0x0f, 0xad, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xd0, 0x50, 0x79, 0x6e,
+	0x63, 0x21, 0x0a, 0xf7, 0xde, 0x80, 0x6e, 0x00, 0x00, 0x00, 0x00, 0xda,
+	0xba, 0x75, 0x9d,
+}
+
+// 由 `lz4 -l` 生成：旧格式帧
+var lz4TestLegacyFrame = []byte{
+	0x02, 0x21, 0x4c, 0x18, 0x21, 0x00, 0x00, 0x00, 0xf0, 0x04, 0x53, 0x79,
+	0x6e, 0x6f, 0x6c, 0x6f, 0x67, 0x79, 0x20, 0x43, 0x6c, 0x6f, 0x75, 0x64,
+	0x20, 0x53, 0x79, 0x6e, 0x63, 0x05, 0x00, 0x0f, 0x14, 0x00, 0x0e, 0x50,
+	0x79, 0x6e, 0x63, 0x21, 0x0a,
+}
+
+func TestXXH32Sum(t *testing.T) {
+	tests := []struct {
+		input string
+		want  uint32
+	}{
+		{"", 0x02CC5D05},
+		{"a", 0x550D7456},
+		{"abc", 0x32D153FF},
+		{"Nobody inspects the spammish repetition", 0xE2293B2F},
+	}
+
+	for _, tt := range tests {
+		if got := XXH32Sum([]byte(tt.input), 0); got != tt.want {
+			t.Errorf("XXH32Sum(%q) = 0x%08X, want 0x%08X", tt.input, got, tt.want)
+		}
+	}
+}
+
+func decompressLz4(t *testing.T, chunks ...[]byte) ([]byte, error) {
+	t.Helper()
+
+	var out bytes.Buffer
+	decompressor, err := NewLz4Decompressor(func(data []byte) {
+		out.Write(data)
+	})
+	if err != nil {
+		t.Fatalf("NewLz4Decompressor() error = %v", err)
+	}
+
+	for _, chunk := range chunks {
+		if err := decompressor.Write(chunk); err != nil {
+			return out.Bytes(), err
+		}
+	}
+	return out.Bytes(), decompressor.Close()
+}
+
+// splitBytes 按固定大小切分数据，模拟流式写入
+func splitBytes(data []byte, size int) [][]byte {
+	var chunks [][]byte
+	for len(data) > size {
+		chunks = append(chunks, data[:size])
+		data = data[size:]
+	}
+	return append(chunks, data)
+}
+
+func TestLz4Decompressor(t *testing.T) {
+	skippable := []byte{0x5A, 0x2A, 0x4D, 0x18, 0x03, 0x00, 0x00, 0x00, 0x01, 0x02, 0x03}
+
+	tests := []struct {
+		name  string
+		input []byte
+		want  string
+	}{
+		{
+			name:  "frame with checksums",
+			input: lz4TestFrame,
+			want:  lz4TestText,
+		},
+		{
+			name:  "legacy frame",
+			input: lz4TestLegacyFrame,
+			want:  lz4TestText,
+		},
+		{
+			name:  "linked blocks",
+			input: lz4TestLinkedFrame,
+			want:  strings.Repeat(lz4TestText, 1200),
+		},
+		{
+			name:  "concatenated and skippable frames",
+			input: bytes.Join([][]byte{lz4TestFrame, skippable, lz4TestLegacyFrame}, nil),
+			want:  lz4TestText + lz4TestText,
+		},
+	}
+
+	for _, tt := range tests {
+		for _, size := range []int{1, 7, len(tt.input)} {
+			got, err := decompressLz4(t, splitBytes(tt.input, size)...)
+			if err != nil {
+				t.Fatalf("%s (chunk %d): error = %v", tt.name, size, err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("%s (chunk %d): got %q, want %q", tt.name, size, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestLz4DecompressorErrors(t *testing.T) {
+	corruptBlock := append([]byte{}, lz4TestFrame...)
+	corruptBlock[30] ^= 0xFF
+
+	corruptHeader := append([]byte{}, lz4TestFrame...)
+	corruptHeader[14] ^= 0xFF
+
+	// 把关联块标记为独立块并重新计算头部校验，第二个块引用的历史数据不可用
+	unlinked := append([]byte{}, lz4TestLinkedFrame...)
+	unlinked[4] |= 0x20
+	unlinked[6] = byte(XXH32Sum(unlinked[4:6], 0) >> 8)
+
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{"truncated frame", lz4TestFrame[:len(lz4TestFrame)-2]},
+		{"block checksum mismatch", corruptBlock},
+		{"header checksum mismatch", corruptHeader},
+		{"linked blocks decoded as independent", unlinked},
+		{"unknown magic", []byte("not an lz4 stream")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decompressLz4(t, tt.input)
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+		})
+	}
+
+	_, err := decompressLz4(t, corruptBlock)
+	if !errors.Is(err, ErrLz4Corrupt) {
+		t.Errorf("error %v should wrap ErrLz4Corrupt", err)
+	}
+}
+
+func TestLz4CompressorRoundTrip(t *testing.T) {
+	random := make([]byte, 200*1024)
+	seed := uint32(1)
+	for i := range random {
+		seed = seed*1664525 + 1013904223
+		random[i] = byte(seed >> 24)
+	}
+
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{"empty", nil},
+		{"short", []byte("hello")},
+		{"repetitive", bytes.Repeat([]byte(lz4TestText), 5000)},
+		{"incompressible", random},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var compressed bytes.Buffer
+			compressor := NewLz4Compressor(&compressed)
+			for _, chunk := range splitBytes(tt.input, 10000) {
+				if _, err := compressor.Write(chunk); err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+			}
+			if err := compressor.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			got, err := decompressLz4(t, compressed.Bytes())
+			if err != nil {
+				t.Fatalf("decompress error = %v", err)
+			}
+			if !bytes.Equal(got, tt.input) {
+				t.Errorf("round trip mismatch: got %d bytes, want %d", len(got), len(tt.input))
+			}
+		})
+	}
+}
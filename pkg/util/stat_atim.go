@@ -0,0 +1,9 @@
+//go:build linux || openbsd || dragonfly
+
+package util
+
+import "syscall"
+
+func statAtime(stat *syscall.Stat_t) syscall.Timespec {
+	return stat.Atim
+}
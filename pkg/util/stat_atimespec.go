@@ -0,0 +1,9 @@
+//go:build darwin || freebsd || netbsd
+
+package util
+
+import "syscall"
+
+func statAtime(stat *syscall.Stat_t) syscall.Timespec {
+	return stat.Atimespec
+}
@@ -0,0 +1,23 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+
+package util
+
+import (
+	"os"
+	"time"
+)
+
+// FileAccessTime 在没有 Stat_t 的平台上返回修改时间
+func FileAccessTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
+
+// FileOwner 在没有 uid/gid 的平台上总是返回 ok 为 false
+func FileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
+
+// CanChown 在没有 uid/gid 的平台上总是返回 false
+func CanChown() bool {
+	return false
+}
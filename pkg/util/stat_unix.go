@@ -0,0 +1,31 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package util
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// FileAccessTime 返回文件的访问时间，无法获取时返回修改时间
+func FileAccessTime(info os.FileInfo) time.Time {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		atime := statAtime(stat)
+		return time.Unix(atime.Unix())
+	}
+	return info.ModTime()
+}
+
+// FileOwner 返回文件的 uid 和 gid，无法获取时 ok 为 false
+func FileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return int(stat.Uid), int(stat.Gid), true
+	}
+	return 0, 0, false
+}
+
+// CanChown 判断当前进程能否修改文件所有者
+func CanChown() bool {
+	return os.Geteuid() == 0
+}
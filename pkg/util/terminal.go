@@ -0,0 +1,49 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ReadPassword 在终端上提示并读取一行输入，终端支持时关闭回显
+func ReadPassword(prompt string) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if !IsTerminal(fd) {
+		return nil, fmt.Errorf("cannot prompt for %q: stdin is not a terminal", strings.TrimSpace(prompt))
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	defer fmt.Fprintln(os.Stderr)
+
+	restore, err := disableEcho(fd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to disable terminal echo: %v", err)
+	}
+	defer restore()
+
+	return readLine(os.Stdin)
+}
+
+// readLine 逐字节读取一行，避免缓冲读取多余的输入
+func readLine(reader io.Reader) ([]byte, error) {
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := reader.Read(buf)
+		if n > 0 {
+			if buf[0] == '\n' {
+				break
+			}
+			line = append(line, buf[0])
+		}
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				break
+			}
+			return nil, err
+		}
+	}
+	return []byte(strings.TrimSuffix(string(line), "\r")), nil
+}
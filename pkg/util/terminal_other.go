@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly && !windows
+
+package util
+
+import "os"
+
+// IsTerminal 在不支持 termios 的平台上只判断是否为字符设备
+func IsTerminal(fd int) bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && int(os.Stdin.Fd()) == fd && info.Mode()&os.ModeCharDevice != 0
+}
+
+// disableEcho 在不支持 termios 的平台上无法关闭回显
+func disableEcho(fd int) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,36 @@
+package util
+
+import "syscall"
+
+const enableEchoInput = 0x0004
+
+var procSetConsoleMode = syscall.NewLazyDLL("kernel32.dll").NewProc("SetConsoleMode")
+
+// IsTerminal 判断句柄是否为控制台
+func IsTerminal(fd int) bool {
+	var mode uint32
+	return syscall.GetConsoleMode(syscall.Handle(fd), &mode) == nil
+}
+
+// disableEcho 关闭控制台回显，返回恢复函数
+func disableEcho(fd int) (func(), error) {
+	handle := syscall.Handle(fd)
+
+	var original uint32
+	if err := syscall.GetConsoleMode(handle, &original); err != nil {
+		return nil, err
+	}
+	if err := setConsoleMode(handle, original&^enableEchoInput); err != nil {
+		return nil, err
+	}
+
+	return func() { setConsoleMode(handle, original) }, nil
+}
+
+func setConsoleMode(handle syscall.Handle, mode uint32) error {
+	r, _, err := procSetConsoleMode.Call(uintptr(handle), uintptr(mode))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
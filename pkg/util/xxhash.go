@@ -0,0 +1,119 @@
+package util
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	xxhPrime32_1 uint32 = 2654435761
+	xxhPrime32_2 uint32 = 2246822519
+	xxhPrime32_3 uint32 = 3266489917
+	xxhPrime32_4 uint32 = 668265263
+	xxhPrime32_5 uint32 = 374761393
+)
+
+// XXH32 流式 xxHash32 计算器，用于 LZ4 帧的头部、块和内容校验
+type XXH32 struct {
+	seed     uint32
+	v1       uint32
+	v2       uint32
+	v3       uint32
+	v4       uint32
+	totalLen uint64
+	mem      [16]byte
+	memSize  int
+}
+
+// NewXXH32 创建指定种子的 xxHash32 计算器
+func NewXXH32(seed uint32) *XXH32 {
+	x := &XXH32{}
+	x.Reset(seed)
+	return x
+}
+
+// Reset 重置计算器状态
+func (x *XXH32) Reset(seed uint32) {
+	*x = XXH32{
+		seed: seed,
+		v1:   seed + xxhPrime32_1 + xxhPrime32_2,
+		v2:   seed + xxhPrime32_2,
+		v3:   seed,
+		v4:   seed - xxhPrime32_1,
+	}
+}
+
+func xxhRound(acc, input uint32) uint32 {
+	acc += input * xxhPrime32_2
+	acc = bits.RotateLeft32(acc, 13)
+	return acc * xxhPrime32_1
+}
+
+// Write 追加数据，始终返回 len(data), nil
+func (x *XXH32) Write(data []byte) (int, error) {
+	n := len(data)
+	x.totalLen += uint64(n)
+
+	if x.memSize+len(data) < 16 {
+		x.memSize += copy(x.mem[x.memSize:], data)
+		return n, nil
+	}
+
+	if x.memSize > 0 {
+		fill := copy(x.mem[x.memSize:], data)
+		data = data[fill:]
+		x.v1 = xxhRound(x.v1, binary.LittleEndian.Uint32(x.mem[0:]))
+		x.v2 = xxhRound(x.v2, binary.LittleEndian.Uint32(x.mem[4:]))
+		x.v3 = xxhRound(x.v3, binary.LittleEndian.Uint32(x.mem[8:]))
+		x.v4 = xxhRound(x.v4, binary.LittleEndian.Uint32(x.mem[12:]))
+		x.memSize = 0
+	}
+
+	for len(data) >= 16 {
+		x.v1 = xxhRound(x.v1, binary.LittleEndian.Uint32(data[0:]))
+		x.v2 = xxhRound(x.v2, binary.LittleEndian.Uint32(data[4:]))
+		x.v3 = xxhRound(x.v3, binary.LittleEndian.Uint32(data[8:]))
+		x.v4 = xxhRound(x.v4, binary.LittleEndian.Uint32(data[12:]))
+		data = data[16:]
+	}
+
+	x.memSize = copy(x.mem[:], data)
+	return n, nil
+}
+
+// Sum32 返回当前摘要，不改变计算器状态
+func (x *XXH32) Sum32() uint32 {
+	var h uint32
+	if x.totalLen >= 16 {
+		h = bits.RotateLeft32(x.v1, 1) + bits.RotateLeft32(x.v2, 7) +
+			bits.RotateLeft32(x.v3, 12) + bits.RotateLeft32(x.v4, 18)
+	} else {
+		h = x.seed + xxhPrime32_5
+	}
+	h += uint32(x.totalLen)
+
+	p := x.mem[:x.memSize]
+	for len(p) >= 4 {
+		h += binary.LittleEndian.Uint32(p) * xxhPrime32_3
+		h = bits.RotateLeft32(h, 17) * xxhPrime32_4
+		p = p[4:]
+	}
+	for _, b := range p {
+		h += uint32(b) * xxhPrime32_5
+		h = bits.RotateLeft32(h, 11) * xxhPrime32_1
+	}
+
+	h ^= h >> 15
+	h *= xxhPrime32_2
+	h ^= h >> 13
+	h *= xxhPrime32_3
+	h ^= h >> 16
+	return h
+}
+
+// XXH32Sum 计算一段数据的 xxHash32
+func XXH32Sum(data []byte, seed uint32) uint32 {
+	x := NewXXH32(seed)
+	x.Write(data)
+	return x.Sum32()
+}